@@ -1,6 +1,7 @@
 package promql_sdk
 
 import (
+	"context"
 	"fmt"
 	"net/url"
 	"time"
@@ -9,14 +10,25 @@ import (
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 
+	"github.com/lwangrabbit/promql-sdk/pkg/scheduler"
+	"github.com/lwangrabbit/promql-sdk/pkg/tracing"
 	"github.com/lwangrabbit/promql-sdk/promql"
 	"github.com/lwangrabbit/promql-sdk/storage"
 	"github.com/lwangrabbit/promql-sdk/util/stats"
 )
 
 var (
-	queryEngine   *promql.Engine
-	remoteStorage storage.Storage
+	queryEngine     *promql.Engine
+	engineOpts      promql.EngineOpts
+	remoteStorage   storage.Storage
+	remoteWriteHead *storage.Head
+
+	activeQueryDir     string
+	activeQueryTracker *promql.ActiveQueryTracker
+
+	remoteReadRetries int
+	breakerThreshold  int
+	breakerCooldown   time.Duration
 )
 
 const (
@@ -34,18 +46,26 @@ type ReadConfig struct {
 }
 
 func Init(configs []*ReadConfig, ops ...func()) error {
-	engineOpts := promql.EngineOpts{
+	engineOpts = promql.EngineOpts{
 		Reg:           prometheus.DefaultRegisterer,
 		MaxConcurrent: DefaultEngineQueryMaxConcurrency,
 		MaxSamples:    DefaultEngineQueryMaxSamples,
 		Timeout:       DefaultEngineQueryTimeout,
 	}
-	queryEngine = promql.NewEngine(engineOpts)
 
 	// Custom configs
 	for _, op := range ops {
 		op()
 	}
+	if activeQueryDir != "" && activeQueryTracker == nil {
+		tracker, err := promql.NewActiveQueryTracker(activeQueryDir, engineOpts.MaxConcurrent, nil)
+		if err != nil {
+			return err
+		}
+		activeQueryTracker = tracker
+	}
+	engineOpts.ActiveQueryTracker = activeQueryTracker
+	queryEngine = promql.NewEngine(engineOpts)
 
 	var err error
 	var rConfs = make([]*storage.RemoteReadConfig, 0, len(configs))
@@ -58,10 +78,21 @@ func Init(configs []*ReadConfig, ops ...func()) error {
 			URL:           &config_util.URL{URL: u},
 			RemoteTimeout: model.Duration(conf.Timeout),
 			Name:          fmt.Sprintf("promql-read-%v", conf.URL),
+			SampleCache:   sampleCache,
+			Reg:           engineOpts.Reg,
+
+			MaxRetries:       remoteReadRetries,
+			BreakerThreshold: breakerThreshold,
+			BreakerCooldown:  model.Duration(breakerCooldown),
+			CoalesceReads:    engineOpts.CoalesceQueries,
 		}
 		rConfs = append(rConfs, rconf)
 	}
-	remoteStorage, err = storage.NewStorage(rConfs)
+	var local []storage.Queryable
+	if remoteWriteHead != nil {
+		local = append(local, remoteWriteHead)
+	}
+	remoteStorage, err = storage.NewStorage(rConfs, local...)
 	if err != nil {
 		return err
 	}
@@ -78,6 +109,169 @@ func LookBackDelta(t time.Duration) func() {
 	}
 }
 
+// RemoteReadRetries retries remote reads failing with a network error or a
+// 5xx response up to maxRetries times with exponential backoff.
+func RemoteReadRetries(maxRetries int) func() {
+	return func() {
+		if maxRetries < 0 {
+			panic("invalid value of remote read retries")
+		}
+		remoteReadRetries = maxRetries
+	}
+}
+
+// RemoteReadCircuitBreaker stops reading from an endpoint for cooldown after
+// threshold consecutive failed reads.
+func RemoteReadCircuitBreaker(threshold int, cooldown time.Duration) func() {
+	return func() {
+		if threshold <= 0 || cooldown <= 0 {
+			panic("invalid value of remote read circuit breaker")
+		}
+		breakerThreshold = threshold
+		breakerCooldown = cooldown
+	}
+}
+
+// CoalesceQueries makes identical concurrent queries share a single
+// evaluation. Identity is the normalised expression plus time range, step,
+// tenant and priority. Identical concurrent remote reads share a single
+// request as well. The shared results must not be modified.
+func CoalesceQueries() func() {
+	return func() {
+		engineOpts.CoalesceQueries = true
+	}
+}
+
+// ExponentialBucketInterpolation makes histogram_quantile and
+// histogram_fraction interpolate exponentially within classic histogram
+// buckets instead of linearly, which fits exponentially growing buckets
+// better.
+func ExponentialBucketInterpolation() func() {
+	return func() {
+		engineOpts.BucketInterpolation = promql.ExponentialInterpolation
+	}
+}
+
+// DateLocation sets the time zone of the date functions such as hour() and
+// day_of_week() that are called without a time zone argument. Defaults to
+// UTC.
+func DateLocation(loc *time.Location) func() {
+	return func() {
+		engineOpts.Location = loc
+	}
+}
+
+// Scheduler replaces the FIFO query queue with fair per-tenant queues. At
+// most maxQueuedPerTenant queries of a tenant wait, zero or less disables
+// the limit. Tenants are dequeued by weighted round robin, tenants missing
+// in weights have a weight of one.
+func Scheduler(maxQueuedPerTenant int, weights map[string]int) func() {
+	return func() {
+		for _, w := range weights {
+			if w <= 0 {
+				panic("invalid value of scheduler tenant weight")
+			}
+		}
+		engineOpts.Scheduler = scheduler.New(scheduler.Opts{
+			Reg:                engineOpts.Reg,
+			MaxConcurrent:      engineOpts.MaxConcurrent,
+			MaxQueuedPerTenant: maxQueuedPerTenant,
+			Weights:            weights,
+		})
+	}
+}
+
+// TenantLimits enforces per-tenant query limits. Tenants missing in
+// overrides, including queries without a tenant, get the defaults.
+func TenantLimits(defaults promql.Limits, overrides map[string]promql.Limits) func() {
+	return func() {
+		engineOpts.Limits = func(tenant string) promql.Limits {
+			if l, ok := overrides[tenant]; ok {
+				return l
+			}
+			return defaults
+		}
+	}
+}
+
+// TrackActiveQueries records the running queries in a file in dir. Queries
+// that were still running when the process crashed are logged by the next
+// Init.
+func TrackActiveQueries(dir string) func() {
+	return func() {
+		if dir == "" {
+			panic("invalid value of active query directory")
+		}
+		activeQueryDir = dir
+	}
+}
+
+// ActiveQueries returns the running queries ordered by their start time.
+// TrackActiveQueries must be passed to Init to enable it.
+func ActiveQueries() []promql.ActiveQuery {
+	if activeQueryTracker == nil {
+		return nil
+	}
+	return activeQueryTracker.Queries()
+}
+
+// QueryLog logs the executed queries that took at least slowThreshold to
+// the logger, for example a promql.NewJSONQueryLogger writing to a rotating
+// logfile.File or a promql.QueryLoggerFunc callback.
+func QueryLog(logger promql.QueryLogger, slowThreshold time.Duration) func() {
+	return func() {
+		if slowThreshold < 0 {
+			panic("invalid value of slow query threshold")
+		}
+		engineOpts.QueryLogger = logger
+		engineOpts.SlowQueryThreshold = slowThreshold
+	}
+}
+
+// Tracer starts the query, remote read and selector spans in t as well as in
+// the global opentracing tracer, for example in tracing.OpenTelemetry. If
+// traceNodes is set, aggregations, function calls and binary operations get
+// spans too.
+func Tracer(t tracing.Tracer, traceNodes bool) func() {
+	return func() {
+		tracing.SetTracer(t)
+		engineOpts.TraceNodes = traceNodes
+	}
+}
+
+// RunningQueries returns the queries that are currently executed by the
+// engine, ordered by their start time.
+func RunningQueries() []promql.RunningQuery {
+	return queryEngine.RunningQueries()
+}
+
+// CancelQuery cancels the running query with the given ID, including its
+// in-flight remote reads. It returns false if no such query is running.
+func CancelQuery(id uint64) bool {
+	return queryEngine.CancelQuery(id)
+}
+
+// Explain returns the fetch plan of the query without executing it: the
+// remote read queries of every selector and the endpoints they would be sent
+// to. A step of zero explains an instant query at endTs.
+func Explain(query string, startTs, endTs int64, step int) (*promql.Explanation, error) {
+	if step == 0 {
+		startTs = endTs
+	}
+	return promql.Explain(remoteStorage, query, time.Unix(startTs, 0), time.Unix(endTs, 0), time.Duration(step)*time.Second)
+}
+
+// ExplainAnalyze executes the query like Explain explains it and adds the
+// profile of every evaluated node to the explanation.
+func ExplainAnalyze(query string, startTs, endTs int64, step int) (*promql.Explanation, error) {
+	if step == 0 {
+		startTs = endTs
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPIRangeQueryTimeout)
+	defer cancel()
+	return queryEngine.ExplainAnalyze(ctx, remoteStorage, query, time.Unix(startTs, 0), time.Unix(endTs, 0), time.Duration(step)*time.Second)
+}
+
 func Query(query string) (*QueryData, error) {
 	return QueryInstant(query, time.Now().Unix())
 }
@@ -96,4 +290,5 @@ type QueryData struct {
 	ResultType promql.ValueType  `json:"resultType"`
 	Result     promql.Value      `json:"result"`
 	Stats      *stats.QueryStats `json:"stats,omitempty"`
+	Warnings   []string          `json:"warnings,omitempty"`
 }
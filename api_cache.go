@@ -0,0 +1,45 @@
+package promql_sdk
+
+import (
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/resultscache"
+	"github.com/lwangrabbit/promql-sdk/storage"
+)
+
+var (
+	resultsCache *resultscache.Cache
+	sampleCache  *storage.SampleCache
+)
+
+// ResultsCache enables caching the results of range queries in memory for at
+// most maxEntries distinct queries. Results newer than maxFreshness are not
+// cached. With the cache enabled the start and end of range queries are
+// aligned to their step.
+func ResultsCache(maxEntries int, maxFreshness time.Duration) func() {
+	return ResultsCacheStore(resultscache.NewLRUStore(maxEntries), maxFreshness)
+}
+
+// ResultsCacheStore enables caching the results of range queries in the
+// given store. Results newer than maxFreshness are not cached.
+func ResultsCacheStore(store resultscache.Store, maxFreshness time.Duration) func() {
+	return func() {
+		if maxFreshness < 0 {
+			panic("invalid value of results cache max freshness")
+		}
+		resultsCache = resultscache.New(store, maxFreshness)
+	}
+}
+
+// SampleCache enables caching the raw samples read from the remote read
+// endpoints in blocks of the given size, holding at most maxBytes of
+// compressed samples. Repeated selects over the same history are then
+// served from memory.
+func SampleCache(blockSize time.Duration, maxBytes int64) func() {
+	return func() {
+		if maxBytes <= 0 {
+			panic("invalid value of sample cache max bytes")
+		}
+		sampleCache = storage.NewSampleCache(blockSize, maxBytes)
+	}
+}
@@ -0,0 +1,63 @@
+package promql_sdk
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/storage"
+)
+
+var externalLabels labels.Labels
+
+// ExternalLabels sets the labels that are attached to all series served by
+// the remote read handler. Labels already present on a series take
+// precedence.
+func ExternalLabels(ls map[string]string) func() {
+	return func() {
+		for name := range ls {
+			if !model.LabelName(name).IsValid() {
+				panic("invalid external label name")
+			}
+		}
+		externalLabels = labels.FromMap(ls)
+	}
+}
+
+// RemoteWrite enables the remote write receiver. Pushed samples are kept in
+// memory for the given retention and are queried together with the remote
+// read endpoints. A maxSeries of zero or less disables the series limit.
+func RemoteWrite(retention time.Duration, maxSeries int) func() {
+	return func() {
+		if retention <= 0 {
+			panic("invalid value of remote write retention")
+		}
+		remoteWriteHead = storage.NewHead(retention, maxSeries)
+	}
+}
+
+// WriteHandler returns the http.Handler accepting Prometheus remote write
+// requests. RemoteWrite must be passed to Init to enable it.
+func WriteHandler() http.Handler {
+	if remoteWriteHead == nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "remote write receiver is not enabled", http.StatusNotFound)
+		})
+	}
+	return storage.NewWriteHandler(remoteWriteHead)
+}
+
+// ReadHandler returns the http.Handler serving Prometheus remote read
+// requests from the merged storage of all remote read endpoints and the
+// remote write receiver. Init must be called before serving requests.
+func ReadHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if remoteStorage == nil {
+			http.Error(w, "storage is not initialized", http.StatusServiceUnavailable)
+			return
+		}
+		storage.NewReadHandler(remoteStorage, externalLabels).ServeHTTP(w, r)
+	})
+}
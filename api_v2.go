@@ -5,13 +5,21 @@ import (
 	"errors"
 	"time"
 
+	"github.com/lwangrabbit/promql-sdk/pkg/resultscache"
+	"github.com/lwangrabbit/promql-sdk/pkg/scheduler"
+	"github.com/lwangrabbit/promql-sdk/pkg/tenant"
+	"github.com/lwangrabbit/promql-sdk/pkg/timestamp"
+	"github.com/lwangrabbit/promql-sdk/promql"
 	"github.com/lwangrabbit/promql-sdk/util/stats"
 )
 
 type InstantQuery struct {
-	Query   string
-	Ts      int64
-	Timeout time.Duration
+	Query         string
+	Ts            int64
+	Timeout       time.Duration
+	Tenant        string
+	Priority      scheduler.Priority
+	DetailedStats bool
 }
 
 func NewInstantQuery(query string, opts ...func(*InstantQuery)) *InstantQuery {
@@ -38,6 +46,28 @@ func InstantQueryTimeout(timeout time.Duration) func(query *InstantQuery) {
 	}
 }
 
+// InstantQueryTenant sets the tenant the query is scheduled for.
+func InstantQueryTenant(tenant string) func(query *InstantQuery) {
+	return func(query *InstantQuery) {
+		query.Tenant = tenant
+	}
+}
+
+// InstantQueryPriority sets the priority the query is scheduled with.
+func InstantQueryPriority(p scheduler.Priority) func(query *InstantQuery) {
+	return func(query *InstantQuery) {
+		query.Priority = p
+	}
+}
+
+// InstantQueryDetailedStats returns the sample, series and remote read
+// statistics of the query in addition to the timings.
+func InstantQueryDetailedStats() func(query *InstantQuery) {
+	return func(query *InstantQuery) {
+		query.DetailedStats = true
+	}
+}
+
 func (q *InstantQuery) Do() (*QueryData, error) {
 	qry, err := queryEngine.NewInstantQuery(remoteStorage, q.Query, time.Unix(q.Ts, 0))
 	if err != nil {
@@ -45,7 +75,7 @@ func (q *InstantQuery) Do() (*QueryData, error) {
 	}
 	defer qry.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), q.Timeout)
+	ctx, cancel := context.WithTimeout(queryContext(q.Tenant, q.Priority, q.DetailedStats), q.Timeout)
 	defer cancel()
 
 	res := qry.Exec(ctx)
@@ -55,16 +85,20 @@ func (q *InstantQuery) Do() (*QueryData, error) {
 	return &QueryData{
 		ResultType: res.Value.Type(),
 		Result:     res.Value,
-		Stats:      stats.NewQueryStats(qry.Stats()),
+		Stats:      queryStats(qry),
+		Warnings:   res.Warnings,
 	}, nil
 }
 
 type RangeQuery struct {
-	Query  string
-	Start  int64
-	End    int64
-	Step   int
-	Timout time.Duration
+	Query         string
+	Start         int64
+	End           int64
+	Step          int
+	Timout        time.Duration
+	Tenant        string
+	Priority      scheduler.Priority
+	DetailedStats bool
 }
 
 func NewRangeQuery(query string, start, end int64, step int, opts ...func(*RangeQuery)) *RangeQuery {
@@ -87,6 +121,30 @@ func RangeQueryTimeout(timeout time.Duration) func(*RangeQuery) {
 	}
 }
 
+// RangeQueryTenant sets the tenant the query is scheduled for.
+func RangeQueryTenant(tenant string) func(*RangeQuery) {
+	return func(query *RangeQuery) {
+		query.Tenant = tenant
+	}
+}
+
+// RangeQueryPriority sets the priority the query is scheduled with.
+func RangeQueryPriority(p scheduler.Priority) func(*RangeQuery) {
+	return func(query *RangeQuery) {
+		query.Priority = p
+	}
+}
+
+// RangeQueryDetailedStats returns the sample, series and remote read
+// statistics of the query, including the samples per step, in addition to
+// the timings. Queries served by the results cache only return the total
+// execution time and the evaluation time of the ranges that were not cached.
+func RangeQueryDetailedStats() func(*RangeQuery) {
+	return func(query *RangeQuery) {
+		query.DetailedStats = true
+	}
+}
+
 func (q *RangeQuery) Do() (*QueryData, error) {
 	if q.Start > q.End {
 		return nil, errors.New("startTs/endTs error")
@@ -99,6 +157,13 @@ func (q *RangeQuery) Do() (*QueryData, error) {
 		return nil, err
 	}
 
+	if resultsCache != nil {
+		// Invalid queries are reported by the engine.
+		if expr, err := promql.ParseExpr(q.Query); err == nil && cacheable(expr) {
+			return q.doCached(expr)
+		}
+	}
+
 	qry, err := queryEngine.NewRangeQuery(
 		remoteStorage,
 		q.Query,
@@ -110,7 +175,7 @@ func (q *RangeQuery) Do() (*QueryData, error) {
 	}
 	defer qry.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), q.Timout)
+	ctx, cancel := context.WithTimeout(queryContext(q.Tenant, q.Priority, q.DetailedStats), q.Timout)
 	defer cancel()
 
 	res := qry.Exec(ctx)
@@ -120,6 +185,112 @@ func (q *RangeQuery) Do() (*QueryData, error) {
 	return &QueryData{
 		ResultType: res.Value.Type(),
 		Result:     res.Value,
-		Stats:      stats.NewQueryStats(qry.Stats()),
+		Stats:      queryStats(qry),
+		Warnings:   res.Warnings,
 	}, nil
 }
+
+// cacheable reports whether the results of the query can be cached per step.
+// The results of queries using @ start() or @ end() depend on the whole range
+// and those pinned by @ to a time that is still fresh may change at any step.
+func cacheable(expr promql.Expr) bool {
+	if promql.UsesStartOrEnd(expr) {
+		return false
+	}
+	until, pinned := promql.PinnedUntil(expr)
+	return !pinned || !resultsCache.Fresh(until)
+}
+
+// doCached runs the query through the results cache, evaluating only the
+// step-aligned ranges that are not cached yet. Only the timings are returned
+// as stats.
+func (q *RangeQuery) doCached(expr promql.Expr) (*QueryData, error) {
+	timers := stats.NewQueryTimers()
+	totalTimer := timers.GetTimer(stats.ExecTotalTime).Start()
+
+	step := time.Duration(q.Step) * time.Second
+	key := resultscache.Key(q.Tenant, expr, step)
+
+	// The engine only sees the uncached parts of the range, so the limits
+	// of the tenant on the whole range and result are enforced here.
+	stepMs := int64(step / time.Millisecond)
+	start, end := resultscache.Align(q.Start*1000, q.End*1000, stepMs)
+	if err := queryEngine.CheckRangeQuery(q.Tenant, expr, timestamp.Time(start), timestamp.Time(end), step, nil); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(queryContext(q.Tenant, q.Priority, q.DetailedStats), q.Timout)
+	defer cancel()
+
+	mat, warnings, err := resultsCache.Do(key, start, end, stepMs, promql.Lookahead(expr), func(start, end int64) (promql.Matrix, []string, error) {
+		// The engine keeps the selected series in the expression, so every
+		// evaluation needs its own.
+		qry, err := queryEngine.NewRangeQuery(
+			remoteStorage,
+			q.Query,
+			timestamp.Time(start),
+			timestamp.Time(end),
+			step)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer qry.Close()
+
+		evalTimer := timers.GetTimer(stats.EvalTotalTime).Start()
+		res := qry.Exec(ctx)
+		evalTimer.Stop()
+		if res.Err != nil {
+			return nil, nil, res.Err
+		}
+		mat, err := res.Matrix()
+		if err != nil {
+			return nil, nil, err
+		}
+		// The points are returned to the pool of the engine on Close.
+		return copyMatrix(mat), res.Warnings, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := queryEngine.CheckRangeQuery(q.Tenant, expr, timestamp.Time(start), timestamp.Time(end), step, mat); err != nil {
+		return nil, err
+	}
+	totalTimer.Stop()
+	return &QueryData{
+		ResultType: mat.Type(),
+		Result:     mat,
+		Stats:      stats.NewQueryStats(timers),
+		Warnings:   warnings,
+	}, nil
+}
+
+// copyMatrix returns a deep copy of the points of m.
+func copyMatrix(m promql.Matrix) promql.Matrix {
+	res := make(promql.Matrix, len(m))
+	for i, s := range m {
+		res[i] = promql.Series{
+			Metric: s.Metric,
+			Points: append([]promql.Point(nil), s.Points...),
+		}
+	}
+	return res
+}
+
+// queryContext returns the base context of a query carrying its tenant and
+// priority.
+func queryContext(id string, p scheduler.Priority, detailedStats bool) context.Context {
+	ctx := context.Background()
+	if id != "" {
+		ctx = tenant.WithID(ctx, id)
+	}
+	if detailedStats {
+		ctx = stats.WithDetailed(ctx)
+	}
+	return scheduler.WithPriority(ctx, p)
+}
+
+func queryStats(qry promql.Query) *stats.QueryStats {
+	qs := stats.NewQueryStats(qry.Stats())
+	qs.Samples = qry.SampleStats()
+	return qs
+}
@@ -0,0 +1,171 @@
+package promql_sdk
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/pkg/resultscache"
+	"github.com/lwangrabbit/promql-sdk/promql"
+	"github.com/lwangrabbit/promql-sdk/storage"
+)
+
+// setupTestStorage serves the queries of the test from a head holding the
+// metric a with the value 1 for the first 5m and the metric b with the
+// value 2 from 15m to 20m, both every 15s.
+func setupTestStorage(t *testing.T, limits promql.LimitsFunc) {
+	h := storage.NewHead(time.Hour, 0)
+	app, err := h.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ts := int64(0); ts <= 300000; ts += 15000 {
+		app.Add(labels.FromStrings(labels.MetricName, "a"), ts, 1)
+		app.Add(labels.FromStrings(labels.MetricName, "b"), ts+900000, 2)
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.NewStorage(nil, h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevStorage, prevEngine, prevCache := remoteStorage, queryEngine, resultsCache
+	t.Cleanup(func() {
+		remoteStorage, queryEngine, resultsCache = prevStorage, prevEngine, prevCache
+	})
+	remoteStorage = s
+	queryEngine = promql.NewEngine(promql.EngineOpts{
+		MaxConcurrent: 1,
+		MaxSamples:    10000,
+		Timeout:       time.Minute,
+		Limits:        limits,
+	})
+	resultsCache = resultscache.New(resultscache.NewLRUStore(10), 0)
+}
+
+func TestCachedRangeQueryResultNotReused(t *testing.T) {
+	setupTestStorage(t, nil)
+
+	first, err := NewRangeQuery("a", 0, 1200, 60).Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := first.Result.String()
+	for _, query := range []string{"b", "a"} {
+		res, err := NewRangeQuery(query, 0, 1200, 60).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := first.Result.String(); got != expected {
+			t.Fatalf("first result changed by %q:\n%s\nexpected:\n%s", query, got, expected)
+		}
+		if query == "a" && res.Result.String() != expected {
+			t.Fatalf("expected cached result:\n%s\ngot:\n%s", expected, res.Result)
+		}
+	}
+}
+
+func TestCachedRangeQueryLimits(t *testing.T) {
+	setupTestStorage(t, func(tenant string) promql.Limits {
+		switch tenant {
+		case "small":
+			return promql.Limits{MaxResultSeries: 1}
+		case "recent":
+			return promql.Limits{MaxQueryLookback: time.Hour}
+		}
+		return promql.Limits{}
+	})
+	query := `{__name__=~"a|b"}`
+
+	// A result of another tenant is not reused.
+	if _, err := NewRangeQuery(query, 0, 1200, 60, RangeQueryTenant("large")).Do(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewRangeQuery(query, 0, 1200, 60, RangeQueryTenant("small")).Do()
+	if _, ok := err.(promql.ErrTooManyResultSeries); !ok {
+		t.Fatalf("expected too many result series, got %v", err)
+	}
+	_, err = NewRangeQuery(query, 0, 1200, 60, RangeQueryTenant("recent")).Do()
+	if _, ok := err.(promql.ErrQueryLookbackTooLong); !ok {
+		t.Fatalf("expected the lookback to be too long, got %v", err)
+	}
+
+	// Every part of the range holds a single series, only the merged
+	// result exceeds the limit. a is gone after 10m, b starts at 15m.
+	if _, err := NewRangeQuery(query, 0, 600, 60, RangeQueryTenant("small")).Do(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewRangeQuery(query, 0, 1200, 60, RangeQueryTenant("small")).Do()
+	if _, ok := err.(promql.ErrTooManyResultSeries); !ok {
+		t.Fatalf("expected too many result series, got %v", err)
+	}
+}
+
+func TestCachedRangeQueryWarnings(t *testing.T) {
+	setupTestStorage(t, nil)
+
+	var expected []string
+	for i := 0; i < 2; i++ {
+		res, err := NewRangeQuery(`histogram_quantile(0.5, a)`, 0, 1200, 60).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if len(res.Warnings) == 0 {
+				t.Fatal("expected warnings for the missing le label")
+			}
+			expected = res.Warnings
+		}
+		if !reflect.DeepEqual(res.Warnings, expected) {
+			t.Fatalf("%d: expected warnings %v, got %v", i, expected, res.Warnings)
+		}
+	}
+}
+
+func TestCachedRangeQueryStats(t *testing.T) {
+	setupTestStorage(t, nil)
+
+	for i, evaluated := range []bool{true, false} {
+		res, err := NewRangeQuery("a", 0, 1200, 60).Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Stats == nil || res.Stats.Timings.ExecTotalTime <= 0 {
+			t.Fatalf("%d: expected the total execution time, got %+v", i, res.Stats)
+		}
+		if got := res.Stats.Timings.EvalTotalTime > 0; got != evaluated {
+			t.Fatalf("%d: expected evaluation %t, got %+v", i, evaluated, res.Stats.Timings)
+		}
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	prevCache := resultsCache
+	t.Cleanup(func() { resultsCache = prevCache })
+	resultsCache = resultscache.New(resultscache.NewLRUStore(10), 10*time.Minute)
+
+	now := time.Now().Unix()
+	for _, c := range []struct {
+		query     string
+		cacheable bool
+	}{
+		{`a`, true},
+		{`a @ 300`, true},
+		{`rate(a[5m] @ end())`, false},
+		{fmt.Sprintf(`a @ %d`, now), false},
+		{fmt.Sprintf(`rate(a[5m] @ %d offset 1h)`, now), true},
+		{fmt.Sprintf(`max_over_time(rate(a[1m])[5m:] @ %d)`, now), false},
+	} {
+		expr, err := promql.ParseExpr(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cacheable(expr); got != c.cacheable {
+			t.Fatalf("%s: expected cacheable %t, got %t", c.query, c.cacheable, got)
+		}
+	}
+}
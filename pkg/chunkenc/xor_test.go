@@ -0,0 +1,79 @@
+// Copyright 2017 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package chunkenc
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+type pair struct {
+	t int64
+	v float64
+}
+
+func TestXORChunk(t *testing.T) {
+	var exp []pair
+	var (
+		ts = int64(1234123324)
+		v  = 1243535.123
+	)
+	for i := 0; i < 300; i++ {
+		ts += int64(rand.Intn(10000) + 1)
+		if i%2 == 0 {
+			v += float64(rand.Intn(1000000))
+		} else {
+			v -= float64(rand.Intn(1000000))
+		}
+		if i%10 == 0 {
+			ts += int64(rand.Intn(1 << 30))
+		}
+		if i == 50 {
+			v = math.NaN()
+		}
+		exp = append(exp, pair{t: ts, v: v})
+	}
+
+	c := NewXORChunk()
+	app := c.Appender()
+	for i, p := range exp {
+		if i == 100 {
+			// Appenders must pick up the state of the existing chunk.
+			app = c.Appender()
+		}
+		app.Append(p.t, p.v)
+	}
+	if c.NumSamples() != len(exp) {
+		t.Fatalf("expected %d samples, got %d", len(exp), c.NumSamples())
+	}
+
+	it := FromData(c.Bytes()).Iterator()
+	var res []pair
+	for it.Next() {
+		ts, v := it.At()
+		res = append(res, pair{t: ts, v: v})
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if len(res) != len(exp) {
+		t.Fatalf("expected %d samples, got %d", len(exp), len(res))
+	}
+	for i := range exp {
+		if exp[i].t != res[i].t || (exp[i].v != res[i].v && !(math.IsNaN(exp[i].v) && math.IsNaN(res[i].v))) {
+			t.Fatalf("sample %d: expected %v, got %v", i, exp[i], res[i])
+		}
+	}
+}
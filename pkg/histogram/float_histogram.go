@@ -0,0 +1,300 @@
+// Package histogram implements native histograms, also known as sparse
+// histograms, with exponential bucket schemas.
+package histogram
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Span defines a number of consecutive buckets with their offset. The offset
+// of the first span is the index of its first bucket, the offset of every
+// following span is the gap to the previous span.
+type Span struct {
+	Offset int32
+	Length uint32
+}
+
+// FloatHistogram is a native histogram with float counts. The buckets hold
+// absolute counts.
+//
+// The schema defines the bucket boundaries: every power of two is divided
+// into 2^Schema logarithmic buckets, so that the upper bound of the bucket
+// with index i is 2^(i*2^-Schema). Observations with an absolute value of at
+// most ZeroThreshold are counted in the zero bucket.
+type FloatHistogram struct {
+	Schema        int32
+	ZeroThreshold float64
+	ZeroCount     float64
+	Count         float64
+	Sum           float64
+
+	PositiveSpans   []Span
+	NegativeSpans   []Span
+	PositiveBuckets []float64
+	NegativeBuckets []float64
+}
+
+// Bucket is a bucket of a histogram with its boundaries.
+type Bucket struct {
+	Lower, Upper float64
+	Count        float64
+}
+
+// Copy returns a deep copy of the histogram.
+func (h *FloatHistogram) Copy() *FloatHistogram {
+	c := *h
+	c.PositiveSpans = append([]Span(nil), h.PositiveSpans...)
+	c.NegativeSpans = append([]Span(nil), h.NegativeSpans...)
+	c.PositiveBuckets = append([]float64(nil), h.PositiveBuckets...)
+	c.NegativeBuckets = append([]float64(nil), h.NegativeBuckets...)
+	return &c
+}
+
+// Mul multiplies all counts and the sum of the histogram by f. The histogram
+// is modified in place and returned.
+func (h *FloatHistogram) Mul(f float64) *FloatHistogram {
+	h.ZeroCount *= f
+	h.Count *= f
+	h.Sum *= f
+	for i := range h.PositiveBuckets {
+		h.PositiveBuckets[i] *= f
+	}
+	for i := range h.NegativeBuckets {
+		h.NegativeBuckets[i] *= f
+	}
+	return h
+}
+
+// Div divides all counts and the sum of the histogram by f. The histogram is
+// modified in place and returned.
+func (h *FloatHistogram) Div(f float64) *FloatHistogram {
+	return h.Mul(1 / f)
+}
+
+// Add adds the other histogram to the histogram. Histograms of different
+// schemas and zero thresholds are converted to the lowest resolution of
+// both. The histogram is modified in place and returned.
+func (h *FloatHistogram) Add(other *FloatHistogram) *FloatHistogram {
+	return h.combine(other, 1)
+}
+
+// Sub subtracts the other histogram from the histogram, converting
+// resolutions like Add. The histogram is modified in place and returned.
+func (h *FloatHistogram) Sub(other *FloatHistogram) *FloatHistogram {
+	return h.combine(other, -1)
+}
+
+func (h *FloatHistogram) combine(other *FloatHistogram, sign float64) *FloatHistogram {
+	schema := h.Schema
+	if other.Schema < schema {
+		schema = other.Schema
+	}
+	a, b := h.expand(schema), other.expand(schema)
+	for a.zeroThreshold != b.zeroThreshold {
+		t := math.Max(a.zeroThreshold, b.zeroThreshold)
+		a.widenZeroBucket(t, schema)
+		b.widenZeroBucket(t, schema)
+	}
+
+	a.zeroCount += sign * b.zeroCount
+	for i, c := range b.positive {
+		a.positive[i] += sign * c
+	}
+	for i, c := range b.negative {
+		a.negative[i] += sign * c
+	}
+
+	h.Schema = schema
+	h.ZeroThreshold = a.zeroThreshold
+	h.ZeroCount = a.zeroCount
+	h.PositiveSpans, h.PositiveBuckets = fromBucketMap(a.positive)
+	h.NegativeSpans, h.NegativeBuckets = fromBucketMap(a.negative)
+	h.Count += sign * other.Count
+	h.Sum += sign * other.Sum
+	return h
+}
+
+// DetectReset reports whether a counter reset happened between the previous
+// histogram and this one, that is whether any count went down or the
+// resolution of the histogram went up.
+func (h *FloatHistogram) DetectReset(previous *FloatHistogram) bool {
+	if h.Count < previous.Count {
+		return true
+	}
+	if h.Schema > previous.Schema || h.ZeroThreshold < previous.ZeroThreshold {
+		return true
+	}
+	prev := previous.expand(h.Schema)
+	prev.widenZeroBucket(h.ZeroThreshold, h.Schema)
+	if prev.zeroThreshold != h.ZeroThreshold {
+		// A bucket of the previous histogram straddles the zero bucket.
+		return true
+	}
+	if h.ZeroCount < prev.zeroCount {
+		return true
+	}
+	cur := h.expand(h.Schema)
+	for i, c := range prev.positive {
+		if cur.positive[i] < c {
+			return true
+		}
+	}
+	for i, c := range prev.negative {
+		if cur.negative[i] < c {
+			return true
+		}
+	}
+	return false
+}
+
+// Buckets returns all buckets of the histogram, including the zero bucket if
+// it is populated, ordered by their boundaries.
+func (h *FloatHistogram) Buckets() []Bucket {
+	var buckets []Bucket
+	neg := bucketIndexes(h.NegativeSpans)
+	for i := len(neg) - 1; i >= 0; i-- {
+		buckets = append(buckets, Bucket{
+			Lower: -bucketBound(neg[i], h.Schema),
+			Upper: -bucketBound(neg[i]-1, h.Schema),
+			Count: h.NegativeBuckets[i],
+		})
+	}
+	if h.ZeroCount != 0 {
+		buckets = append(buckets, Bucket{
+			Lower: -h.ZeroThreshold,
+			Upper: h.ZeroThreshold,
+			Count: h.ZeroCount,
+		})
+	}
+	for i, idx := range bucketIndexes(h.PositiveSpans) {
+		buckets = append(buckets, Bucket{
+			Lower: bucketBound(idx-1, h.Schema),
+			Upper: bucketBound(idx, h.Schema),
+			Count: h.PositiveBuckets[i],
+		})
+	}
+	return buckets
+}
+
+func (h *FloatHistogram) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "{count:%g, sum:%g", h.Count, h.Sum)
+	for _, b := range h.Buckets() {
+		fmt.Fprintf(&sb, ", [%g,%g]:%g", b.Lower, b.Upper, b.Count)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// bucketBound returns the upper bound of the positive bucket with the given
+// index.
+func bucketBound(idx, schema int32) float64 {
+	return math.Exp2(float64(idx) * math.Exp2(-float64(schema)))
+}
+
+// bucketIndexes returns the index of every bucket described by the spans.
+func bucketIndexes(spans []Span) []int32 {
+	var (
+		idxs []int32
+		idx  int32
+	)
+	for i, s := range spans {
+		if i == 0 {
+			idx = s.Offset
+		} else {
+			idx += s.Offset
+		}
+		for j := uint32(0); j < s.Length; j++ {
+			idxs = append(idxs, idx)
+			idx++
+		}
+	}
+	return idxs
+}
+
+// expanded is a histogram with its buckets keyed by index, which makes
+// combining histograms of different layouts straightforward.
+type expanded struct {
+	zeroThreshold, zeroCount float64
+	positive, negative       map[int32]float64
+}
+
+// expand returns the buckets of the histogram converted to the given schema,
+// which must not be higher than the schema of the histogram.
+func (h *FloatHistogram) expand(schema int32) *expanded {
+	return &expanded{
+		zeroThreshold: h.ZeroThreshold,
+		zeroCount:     h.ZeroCount,
+		positive:      bucketMap(h.PositiveSpans, h.PositiveBuckets, h.Schema-schema),
+		negative:      bucketMap(h.NegativeSpans, h.NegativeBuckets, h.Schema-schema),
+	}
+}
+
+// widenZeroBucket merges all buckets overlapping the threshold into the zero
+// bucket. The threshold grows to the upper bound of the largest merged
+// bucket.
+func (e *expanded) widenZeroBucket(threshold float64, schema int32) {
+	if threshold > e.zeroThreshold {
+		e.zeroThreshold = threshold
+	}
+	for {
+		threshold := e.zeroThreshold
+		for _, buckets := range []map[int32]float64{e.positive, e.negative} {
+			for idx, c := range buckets {
+				if bucketBound(idx-1, schema) >= e.zeroThreshold {
+					continue
+				}
+				e.zeroCount += c
+				e.zeroThreshold = math.Max(e.zeroThreshold, bucketBound(idx, schema))
+				delete(buckets, idx)
+			}
+		}
+		if e.zeroThreshold == threshold {
+			return
+		}
+	}
+}
+
+// bucketMap returns the counts of the buckets by index, reducing the
+// resolution by scaleDown schema steps.
+func bucketMap(spans []Span, buckets []float64, scaleDown int32) map[int32]float64 {
+	m := make(map[int32]float64, len(buckets))
+	for i, idx := range bucketIndexes(spans) {
+		m[((idx-1)>>uint(scaleDown))+1] += buckets[i]
+	}
+	return m
+}
+
+// fromBucketMap returns the spans and buckets of the non-empty buckets in m.
+func fromBucketMap(m map[int32]float64) ([]Span, []float64) {
+	idxs := make([]int32, 0, len(m))
+	for idx, c := range m {
+		if c != 0 {
+			idxs = append(idxs, idx)
+		}
+	}
+	if len(idxs) == 0 {
+		return nil, nil
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+
+	var (
+		spans   []Span
+		buckets = make([]float64, 0, len(idxs))
+	)
+	for i, idx := range idxs {
+		switch {
+		case i == 0:
+			spans = append(spans, Span{Offset: idx, Length: 1})
+		case idx == idxs[i-1]+1:
+			spans[len(spans)-1].Length++
+		default:
+			spans = append(spans, Span{Offset: idx - idxs[i-1] - 1, Length: 1})
+		}
+		buckets = append(buckets, m[idx])
+	}
+	return spans, buckets
+}
@@ -0,0 +1,45 @@
+package histogram
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddReducesResolution(t *testing.T) {
+	fine := &FloatHistogram{
+		Schema:          1,
+		Count:           10,
+		Sum:             20,
+		PositiveSpans:   []Span{{Offset: 1, Length: 4}},
+		PositiveBuckets: []float64{1, 2, 3, 4},
+	}
+	coarse := &FloatHistogram{
+		Schema:          0,
+		Count:           30,
+		Sum:             70,
+		PositiveSpans:   []Span{{Offset: 1, Length: 2}},
+		PositiveBuckets: []float64{10, 20},
+	}
+
+	sum := fine.Copy().Add(coarse)
+	expected := &FloatHistogram{
+		Schema:          0,
+		Count:           40,
+		Sum:             90,
+		PositiveSpans:   []Span{{Offset: 1, Length: 2}},
+		PositiveBuckets: []float64{13, 27},
+	}
+	if !reflect.DeepEqual(sum, expected) {
+		t.Fatalf("expected %v, got %v", expected, sum)
+	}
+	if fine.Schema != 1 || len(fine.PositiveBuckets) != 4 {
+		t.Fatalf("Add modified the copied histogram: %v", fine)
+	}
+
+	if coarse.DetectReset(fine) {
+		t.Fatalf("unexpected counter reset from %v to %v", fine, coarse)
+	}
+	if !fine.DetectReset(coarse) {
+		t.Fatalf("expected counter reset from %v to %v", coarse, fine)
+	}
+}
@@ -0,0 +1,100 @@
+// Package logfile provides a log file that rotates itself by size.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File is an io.WriteCloser appending to a file that is rotated once it
+// grows over a maximum size. Rotated files get the suffixes .1 to
+// .maxBackups, .1 being the most recent one.
+type File struct {
+	mtx        sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	f          *os.File
+	size       int64
+}
+
+// Open opens the log file at path for appending. A maxSize of zero or less
+// disables rotation.
+func Open(path string, maxSize int64, maxBackups int) (*File, error) {
+	lf := &File{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+	return lf, nil
+}
+
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	lf.f = f
+	lf.size = fi.Size()
+	return nil
+}
+
+// Write implements io.Writer. The file is rotated before the write if it
+// would grow over the maximum size.
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mtx.Lock()
+	defer lf.mtx.Unlock()
+
+	if lf.maxSize > 0 && lf.size > 0 && lf.size+int64(len(p)) > lf.maxSize {
+		if err := lf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups, moves the current file to the first backup and
+// opens a new file. The caller must hold the lock.
+func (lf *File) rotate() error {
+	if err := lf.f.Close(); err != nil {
+		return err
+	}
+	if lf.maxBackups <= 0 {
+		if err := os.Remove(lf.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return lf.open()
+	}
+	for i := lf.maxBackups - 1; i > 0; i-- {
+		err := os.Rename(backupName(lf.path, i), backupName(lf.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(lf.path, backupName(lf.path, 1)); err != nil {
+		return err
+	}
+	return lf.open()
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
+
+// Close implements io.Closer.
+func (lf *File) Close() error {
+	lf.mtx.Lock()
+	defer lf.mtx.Unlock()
+	return lf.f.Close()
+}
@@ -0,0 +1,47 @@
+package logfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "query.log")
+	f, err := Open(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		path:        "dddddd\n",
+		path + ".1": "cccccc\n",
+		path + ".2": "bbbbbb\n",
+	} {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Fatalf("expected %q in %s, got %q", expected, name, b)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected only two backups, got %v", err)
+	}
+}
@@ -0,0 +1,236 @@
+// Package resultscache caches the results of range queries as extents of
+// step-aligned matrices, so that repeated queries over a moving window only
+// evaluate the parts that are not cached yet.
+package resultscache
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/promql"
+)
+
+// Extent is a cached, step-aligned part of the result of a range query.
+// Start and End are inclusive timestamps in milliseconds. Warnings are the
+// warnings raised while evaluating the extent.
+type Extent struct {
+	Start    int64
+	End      int64
+	Matrix   promql.Matrix
+	Warnings []string
+}
+
+// ExecFunc evaluates the range query for the given inclusive range, in
+// milliseconds, at the step of the cached query, and returns its result and
+// warnings. The returned matrix is owned by the cache, its points must not be
+// reused once ExecFunc returned.
+type ExecFunc func(start, end int64) (promql.Matrix, []string, error)
+
+// Cache is a results cache for range queries.
+type Cache struct {
+	store        Store
+	maxFreshness int64
+	now          func() int64
+}
+
+// New returns a Cache backed by the given store. Results newer than
+// maxFreshness relative to the current time are never cached, as they may
+// still change while late samples arrive.
+func New(store Store, maxFreshness time.Duration) *Cache {
+	return &Cache{
+		store:        store,
+		maxFreshness: int64(maxFreshness / time.Millisecond),
+		now: func() int64 {
+			return time.Now().UnixNano() / int64(time.Millisecond)
+		},
+	}
+}
+
+// Fresh reports whether data at the timestamp t in milliseconds is newer
+// than the max freshness and may thus still change.
+func (c *Cache) Fresh(t int64) bool {
+	return t > c.now()-c.maxFreshness
+}
+
+// Key returns the cache key of the query expression of the tenant evaluated
+// at the given step. The query is normalised by printing the expression.
+func Key(tenant string, expr promql.Expr, step time.Duration) string {
+	return fmt.Sprintf("%q:%s:%d", tenant, expr.String(), int64(step/time.Millisecond))
+}
+
+// Align returns start and end aligned down to a multiple of step.
+func Align(start, end, step int64) (int64, int64) {
+	return start - start%step, end - end%step
+}
+
+// Do returns the result and warnings of the query identified by key for the
+// inclusive range [start, end] at the given step, all in milliseconds. The
+// range must be aligned to the step. Only the parts of the range that are not
+// cached are evaluated by exec. lookahead is how far past a step the query
+// reads, such as with a negative offset, and delays caching by as much.
+func (c *Cache) Do(key string, start, end, step, lookahead int64, exec ExecFunc) (promql.Matrix, []string, error) {
+	extents, _ := c.store.Fetch(key)
+
+	var (
+		results  = make([]promql.Matrix, 0, len(extents)+2)
+		warnings []string
+		computed []Extent
+		cur      = start
+	)
+	for _, e := range extents {
+		if e.End < cur {
+			continue
+		}
+		if e.Start > end {
+			break
+		}
+		if e.Start > cur {
+			m, w, err := exec(cur, e.Start-step)
+			if err != nil {
+				return nil, nil, err
+			}
+			computed = append(computed, Extent{Start: cur, End: e.Start - step, Matrix: clip(m, cur, e.Start-step), Warnings: w})
+		}
+		results = append(results, clip(e.Matrix, start, end))
+		warnings = mergeWarnings(warnings, e.Warnings)
+		cur = e.End + step
+	}
+	if cur <= end {
+		m, w, err := exec(cur, end)
+		if err != nil {
+			return nil, nil, err
+		}
+		computed = append(computed, Extent{Start: cur, End: end, Matrix: clip(m, cur, end), Warnings: w})
+	}
+	for _, e := range computed {
+		results = append(results, e.Matrix)
+		warnings = mergeWarnings(warnings, e.Warnings)
+	}
+
+	if cacheable := c.cacheableExtents(computed, step, lookahead); len(cacheable) > 0 {
+		c.store.Store(key, mergeExtents(append(cacheable, extents...), step))
+	}
+	return mergeMatrices(results...), warnings, nil
+}
+
+// cacheableExtents clips the computed extents to the freshness window.
+func (c *Cache) cacheableExtents(computed []Extent, step, lookahead int64) []Extent {
+	maxt := c.now() - c.maxFreshness - lookahead
+	maxt -= maxt % step
+
+	cacheable := make([]Extent, 0, len(computed))
+	for _, e := range computed {
+		if e.Start > maxt {
+			continue
+		}
+		if e.End > maxt {
+			// The warnings can not be attributed to steps and are kept.
+			e = Extent{Start: e.Start, End: maxt, Matrix: clip(e.Matrix, e.Start, maxt), Warnings: e.Warnings}
+		}
+		cacheable = append(cacheable, e)
+	}
+	return cacheable
+}
+
+// mergeExtents sorts the extents and merges the ones that overlap or are
+// adjacent on the step grid.
+func mergeExtents(extents []Extent, step int64) []Extent {
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].Start < extents[j].Start
+	})
+
+	merged := make([]Extent, 0, len(extents))
+	for _, e := range extents {
+		if n := len(merged); n > 0 && e.Start <= merged[n-1].End+step {
+			last := &merged[n-1]
+			last.Matrix = mergeMatrices(last.Matrix, e.Matrix)
+			last.Warnings = mergeWarnings(last.Warnings, e.Warnings)
+			if e.End > last.End {
+				last.End = e.End
+			}
+			continue
+		}
+		merged = append(merged, e)
+	}
+	return merged
+}
+
+// mergeWarnings appends the warnings of b missing from a to a copy of a.
+func mergeWarnings(a, b []string) []string {
+	res := append([]string(nil), a...)
+	for _, w := range b {
+		found := false
+		for _, x := range res {
+			if x == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			res = append(res, w)
+		}
+	}
+	return res
+}
+
+// clip returns a copy of the matrix holding only the points within the
+// inclusive range [mint, maxt].
+func clip(m promql.Matrix, mint, maxt int64) promql.Matrix {
+	res := make(promql.Matrix, 0, len(m))
+	for _, s := range m {
+		i := sort.Search(len(s.Points), func(n int) bool {
+			return s.Points[n].T >= mint
+		})
+		j := sort.Search(len(s.Points), func(n int) bool {
+			return s.Points[n].T > maxt
+		})
+		if i >= j {
+			continue
+		}
+		points := make([]promql.Point, j-i)
+		copy(points, s.Points[i:j])
+		res = append(res, promql.Series{Metric: s.Metric, Points: points})
+	}
+	return res
+}
+
+// mergeMatrices merges the series of all matrices by their labels into a new
+// matrix. Points of a series are sorted by time and duplicates are dropped.
+func mergeMatrices(ms ...promql.Matrix) promql.Matrix {
+	var (
+		res   promql.Matrix
+		index = map[uint64]int{}
+	)
+	for _, m := range ms {
+		for _, s := range m {
+			h := s.Metric.Hash()
+			i, ok := index[h]
+			if !ok {
+				index[h] = len(res)
+				res = append(res, promql.Series{
+					Metric: s.Metric,
+					Points: append([]promql.Point(nil), s.Points...),
+				})
+				continue
+			}
+			res[i].Points = append(res[i].Points, s.Points...)
+		}
+	}
+	for i := range res {
+		points := res[i].Points
+		sort.SliceStable(points, func(a, b int) bool {
+			return points[a].T < points[b].T
+		})
+		dedup := points[:0]
+		for _, p := range points {
+			if n := len(dedup); n > 0 && dedup[n-1].T == p.T {
+				continue
+			}
+			dedup = append(dedup, p)
+		}
+		res[i].Points = dedup
+	}
+	sort.Sort(res)
+	return res
+}
@@ -0,0 +1,120 @@
+package resultscache
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/promql"
+)
+
+func TestCacheDo(t *testing.T) {
+	const step = 10
+	lset := labels.FromStrings("job", "a")
+
+	var ranges [][2]int64
+	exec := func(start, end int64) (promql.Matrix, []string, error) {
+		ranges = append(ranges, [2]int64{start, end})
+		s := promql.Series{Metric: lset}
+		for ts := start; ts <= end; ts += step {
+			s.Points = append(s.Points, promql.Point{T: ts, V: float64(ts)})
+		}
+		return promql.Matrix{s}, nil, nil
+	}
+
+	c := New(NewLRUStore(10), 20*time.Millisecond)
+	c.now = func() int64 { return 200 }
+
+	cases := []struct {
+		start, end int64
+		ranges     [][2]int64
+	}{
+		// Everything after 180 is too fresh to be cached.
+		{start: 100, end: 200, ranges: [][2]int64{{100, 200}}},
+		{start: 100, end: 200, ranges: [][2]int64{{190, 200}}},
+		{start: 50, end: 250, ranges: [][2]int64{{50, 90}, {190, 250}}},
+		{start: 60, end: 150, ranges: nil},
+	}
+	for i, tc := range cases {
+		ranges = nil
+		m, _, err := c.Do("key", tc.start, tc.end, step, 0, exec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ranges) != len(tc.ranges) {
+			t.Fatalf("%d: expected evaluated ranges %v, got %v", i, tc.ranges, ranges)
+		}
+		for j := range ranges {
+			if ranges[j] != tc.ranges[j] {
+				t.Fatalf("%d: expected evaluated ranges %v, got %v", i, tc.ranges, ranges)
+			}
+		}
+		if len(m) != 1 || int64(len(m[0].Points)) != (tc.end-tc.start)/step+1 {
+			t.Fatalf("%d: unexpected result %v", i, m)
+		}
+		for j, p := range m[0].Points {
+			if p.T != tc.start+int64(j)*step || p.V != float64(p.T) {
+				t.Fatalf("%d: unexpected point %v at %d", i, p, j)
+			}
+		}
+	}
+}
+
+func TestCacheDoLookahead(t *testing.T) {
+	const step = 10
+	var ranges [][2]int64
+	exec := func(start, end int64) (promql.Matrix, []string, error) {
+		ranges = append(ranges, [2]int64{start, end})
+		s := promql.Series{Metric: labels.FromStrings("job", "a")}
+		for ts := start; ts <= end; ts += step {
+			s.Points = append(s.Points, promql.Point{T: ts, V: float64(ts)})
+		}
+		return promql.Matrix{s}, nil, nil
+	}
+
+	c := New(NewLRUStore(10), 20*time.Millisecond)
+	c.now = func() int64 { return 200 }
+
+	// Reading 30ms past each step, everything after 150 is too fresh.
+	for i, expected := range [][2]int64{{100, 200}, {160, 200}} {
+		ranges = nil
+		if _, _, err := c.Do("key", 100, 200, step, 30, exec); err != nil {
+			t.Fatal(err)
+		}
+		if len(ranges) != 1 || ranges[0] != expected {
+			t.Fatalf("%d: expected evaluated range %v, got %v", i, expected, ranges)
+		}
+	}
+}
+
+func TestCacheDoWarnings(t *testing.T) {
+	const step = 10
+	exec := func(start, end int64) (promql.Matrix, []string, error) {
+		return promql.Matrix{}, []string{fmt.Sprintf("warning %d", start)}, nil
+	}
+
+	c := New(NewLRUStore(10), 0)
+	c.now = func() int64 { return 200 }
+
+	for i, tc := range []struct {
+		start, end int64
+		warnings   []string
+	}{
+		{start: 100, end: 150, warnings: []string{"warning 100"}},
+		// The warnings of the cached extent are returned on a hit.
+		{start: 100, end: 150, warnings: []string{"warning 100"}},
+		{start: 50, end: 150, warnings: []string{"warning 100", "warning 50"}},
+		// The extents are merged in order of time.
+		{start: 60, end: 80, warnings: []string{"warning 50", "warning 100"}},
+	} {
+		_, warnings, err := c.Do("key", tc.start, tc.end, step, 0, exec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(warnings, tc.warnings) {
+			t.Fatalf("%d: expected warnings %v, got %v", i, tc.warnings, warnings)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package resultscache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Store holds the cached extents of queries. Implementations must be safe
+// for concurrent use.
+type Store interface {
+	// Fetch returns the extents stored for the key, sorted by start time.
+	Fetch(key string) ([]Extent, bool)
+	// Store replaces the extents stored for the key.
+	Store(key string, extents []Extent)
+}
+
+// lruStore is an in-memory Store evicting the least recently used key once
+// it holds more than maxEntries keys.
+type lruStore struct {
+	mtx        sync.Mutex
+	maxEntries int
+	ll         *list.List
+	items      map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	extents []Extent
+}
+
+// NewLRUStore returns an in-memory Store holding at most maxEntries keys.
+func NewLRUStore(maxEntries int) Store {
+	return &lruStore{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+// Fetch implements Store.
+func (s *lruStore) Fetch(key string) ([]Extent, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).extents, true
+}
+
+// Store implements Store.
+func (s *lruStore) Store(key string, extents []Extent) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if e, ok := s.items[key]; ok {
+		s.ll.MoveToFront(e)
+		e.Value.(*lruEntry).extents = extents
+		return
+	}
+	s.items[key] = s.ll.PushFront(&lruEntry{key: key, extents: extents})
+	for s.maxEntries > 0 && s.ll.Len() > s.maxEntries {
+		e := s.ll.Back()
+		s.ll.Remove(e)
+		delete(s.items, e.Value.(*lruEntry).key)
+	}
+}
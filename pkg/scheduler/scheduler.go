@@ -0,0 +1,278 @@
+// Package scheduler limits the number of concurrently executed queries while
+// dequeuing waiting queries fairly across tenants.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Priority of a query. Waiting queries of a higher priority are always
+// dequeued before queries of a lower priority.
+type Priority int
+
+// Possible query priorities. The zero value is PriorityNormal.
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh-PriorityLow) + 1
+)
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of the context carrying the query priority.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the query priority of the context, defaulting
+// to PriorityNormal.
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= PriorityLow && p <= PriorityHigh {
+		return p
+	}
+	return PriorityNormal
+}
+
+// ErrQueueFull is returned if a tenant already has the maximum number of
+// queries waiting.
+type ErrQueueFull string
+
+func (e ErrQueueFull) Error() string {
+	return fmt.Sprintf("too many queued queries for tenant %q", string(e))
+}
+
+// Opts contains configuration options used when creating a new Scheduler.
+type Opts struct {
+	Reg prometheus.Registerer
+	// MaxConcurrent is the number of queries executed concurrently.
+	MaxConcurrent int
+	// MaxQueuedPerTenant is the number of queries a single tenant may have
+	// waiting. Zero or less disables the limit.
+	MaxQueuedPerTenant int
+	// Weights of the tenants for the weighted fair dequeue. Tenants that are
+	// not listed have a weight of one, which results in round robin.
+	Weights map[string]int
+}
+
+type metrics struct {
+	queueDuration *prometheus.HistogramVec
+	queueLength   *prometheus.GaugeVec
+	rejected      *prometheus.CounterVec
+}
+
+// Scheduler controls the maximum number of concurrently running queries. It
+// replaces the FIFO behavior of a gate with per-tenant queues.
+type Scheduler struct {
+	mtx           sync.Mutex
+	maxConcurrent int
+	maxQueued     int
+	weights       map[string]int
+	running       int
+	queued        int
+	// Tenants with waiting queries in the order they started waiting.
+	tenants []*tenantQueue
+	byName  map[string]*tenantQueue
+
+	metrics *metrics
+}
+
+// tenantQueue holds the waiting queries of a tenant per priority.
+type tenantQueue struct {
+	name    string
+	weight  int
+	current int // Current weight of the smooth weighted round robin.
+	queues  [numPriorities][]*waiter
+	queued  int
+}
+
+type waiter struct {
+	ready      chan struct{}
+	dispatched bool
+}
+
+// New returns a new Scheduler.
+func New(opts Opts) *Scheduler {
+	m := &metrics{
+		queueDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "prometheus",
+			Subsystem: "engine",
+			Name:      "query_queue_duration_seconds",
+			Help:      "Time queries spent waiting in the scheduler queue.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"tenant"}),
+		queueLength: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "prometheus",
+			Subsystem: "engine",
+			Name:      "queries_queued",
+			Help:      "The current number of queries waiting in the scheduler queue.",
+		}, []string{"tenant"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "prometheus",
+			Subsystem: "engine",
+			Name:      "queries_rejected_total",
+			Help:      "The total number of queries rejected because of a full tenant queue.",
+		}, []string{"tenant"}),
+	}
+	if opts.Reg != nil {
+		opts.Reg.MustRegister(m.queueDuration, m.queueLength, m.rejected)
+	}
+	return &Scheduler{
+		maxConcurrent: opts.MaxConcurrent,
+		maxQueued:     opts.MaxQueuedPerTenant,
+		weights:       opts.Weights,
+		byName:        map[string]*tenantQueue{},
+		metrics:       m,
+	}
+}
+
+// Start blocks until the query may be executed or the context is done. A
+// query that is started must be finished with Done.
+func (s *Scheduler) Start(ctx context.Context, tenant string, p Priority) error {
+	if p < PriorityLow || p > PriorityHigh {
+		p = PriorityNormal
+	}
+	start := time.Now()
+	defer func() {
+		s.metrics.queueDuration.WithLabelValues(tenant).Observe(time.Since(start).Seconds())
+	}()
+
+	s.mtx.Lock()
+	if s.running < s.maxConcurrent && s.queued == 0 {
+		s.running++
+		s.mtx.Unlock()
+		return nil
+	}
+
+	tq, ok := s.byName[tenant]
+	if !ok {
+		tq = &tenantQueue{name: tenant, weight: s.weight(tenant)}
+		s.byName[tenant] = tq
+		s.tenants = append(s.tenants, tq)
+	}
+	if s.maxQueued > 0 && tq.queued >= s.maxQueued {
+		s.mtx.Unlock()
+		s.metrics.rejected.WithLabelValues(tenant).Inc()
+		return ErrQueueFull(tenant)
+	}
+	w := &waiter{ready: make(chan struct{})}
+	i := int(p - PriorityLow)
+	tq.queues[i] = append(tq.queues[i], w)
+	tq.queued++
+	s.queued++
+	s.metrics.queueLength.WithLabelValues(tenant).Inc()
+	s.mtx.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if w.dispatched {
+		// The query got its turn while the context was done; hand it on.
+		s.running--
+		s.dispatch()
+		return ctx.Err()
+	}
+	q := tq.queues[i]
+	for j := range q {
+		if q[j] == w {
+			tq.queues[i] = append(q[:j], q[j+1:]...)
+			break
+		}
+	}
+	s.dequeued(tq)
+	return ctx.Err()
+}
+
+// Done releases the execution slot of a started query.
+func (s *Scheduler) Done() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.running == 0 {
+		panic("scheduler.Done: more operations done than started")
+	}
+	s.running--
+	s.dispatch()
+}
+
+func (s *Scheduler) weight(tenant string) int {
+	if w, ok := s.weights[tenant]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// dispatch hands free execution slots to waiting queries. The caller must
+// hold the lock.
+func (s *Scheduler) dispatch() {
+	for s.running < s.maxConcurrent {
+		w := s.next()
+		if w == nil {
+			return
+		}
+		w.dispatched = true
+		s.running++
+		close(w.ready)
+	}
+}
+
+// next dequeues the next waiting query. Among the tenants with queries of
+// the highest waiting priority, the tenant is picked by smooth weighted
+// round robin. The caller must hold the lock.
+func (s *Scheduler) next() *waiter {
+	for p := numPriorities - 1; p >= 0; p-- {
+		var (
+			best  *tenantQueue
+			total int
+		)
+		for _, tq := range s.tenants {
+			if len(tq.queues[p]) == 0 {
+				continue
+			}
+			tq.current += tq.weight
+			total += tq.weight
+			if best == nil || tq.current > best.current {
+				best = tq
+			}
+		}
+		if best == nil {
+			continue
+		}
+		best.current -= total
+
+		w := best.queues[p][0]
+		best.queues[p] = best.queues[p][1:]
+		s.dequeued(best)
+		return w
+	}
+	return nil
+}
+
+// dequeued accounts for a query that left the queue of the tenant and drops
+// the tenant once it has no waiting queries. The caller must hold the lock.
+func (s *Scheduler) dequeued(tq *tenantQueue) {
+	tq.queued--
+	s.queued--
+	s.metrics.queueLength.WithLabelValues(tq.name).Dec()
+	if tq.queued > 0 {
+		return
+	}
+	delete(s.byName, tq.name)
+	for i, t := range s.tenants {
+		if t == tq {
+			s.tenants = append(s.tenants[:i], s.tenants[i+1:]...)
+			break
+		}
+	}
+}
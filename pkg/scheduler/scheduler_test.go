@@ -0,0 +1,57 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerFairDequeue(t *testing.T) {
+	s := New(Opts{MaxConcurrent: 1, MaxQueuedPerTenant: 3})
+	ctx := context.Background()
+	if err := s.Start(ctx, "a", PriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan string, 10)
+	queued := 0
+	enqueue := func(tenant string, p Priority) {
+		go func() {
+			if err := s.Start(ctx, tenant, p); err != nil {
+				t.Error(err)
+				return
+			}
+			order <- tenant
+		}()
+		// Wait for the query to be queued to get a deterministic order.
+		queued++
+		for {
+			s.mtx.Lock()
+			n := s.queued
+			s.mtx.Unlock()
+			if n == queued {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	enqueue("a", PriorityNormal)
+	enqueue("a", PriorityNormal)
+	enqueue("a", PriorityNormal)
+	enqueue("b", PriorityNormal)
+	enqueue("b", PriorityNormal)
+	enqueue("c", PriorityHigh)
+
+	if err := s.Start(ctx, "a", PriorityNormal); err != ErrQueueFull("a") {
+		t.Fatalf("expected %v, got %v", ErrQueueFull("a"), err)
+	}
+
+	expected := []string{"c", "a", "b", "a", "b", "a"}
+	for i, tenant := range expected {
+		s.Done()
+		if got := <-order; got != tenant {
+			t.Fatalf("%d: expected tenant %q, got %q", i, tenant, got)
+		}
+	}
+	s.Done()
+}
@@ -0,0 +1,104 @@
+// Package singleflight provides a duplicate call suppression mechanism that
+// is aware of the contexts of its callers.
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Group coalesces concurrent calls with the same key into a single call.
+// The zero value is ready to use.
+type Group struct {
+	mtx   sync.Mutex
+	calls map[string]*call
+}
+
+// call is an in-flight or completed Do call.
+type call struct {
+	done    chan struct{}
+	val     interface{}
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Do executes fn once for all concurrent callers with the same key and
+// returns its result to all of them. shared reports whether the result was
+// given to more than one caller.
+//
+// fn is run with a context that carries the values of the first caller's
+// context but is only canceled once all callers waiting for the result have
+// gone away. A caller whose context is done returns its context's error
+// immediately, while the call keeps running for the remaining callers.
+func (g *Group) Do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (v interface{}, shared bool, err error) {
+	g.mtx.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*call{}
+	}
+	c, ok := g.calls[key]
+	if ok {
+		c.waiters++
+		g.mtx.Unlock()
+		return g.wait(ctx, key, c, true)
+	}
+
+	fctx, cancel := context.WithCancel(detachedContext{ctx})
+	c = &call{
+		done:    make(chan struct{}),
+		waiters: 1,
+		cancel:  cancel,
+	}
+	g.calls[key] = c
+	g.mtx.Unlock()
+
+	go func() {
+		c.val, c.err = fn(fctx)
+		cancel()
+
+		g.mtx.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.mtx.Unlock()
+		close(c.done)
+	}()
+
+	return g.wait(ctx, key, c, false)
+}
+
+func (g *Group) wait(ctx context.Context, key string, c *call, follower bool) (interface{}, bool, error) {
+	select {
+	case <-c.done:
+		g.mtx.Lock()
+		shared := follower || c.waiters > 1
+		g.mtx.Unlock()
+		return c.val, shared, c.err
+	case <-ctx.Done():
+	}
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	c.waiters--
+	if c.waiters == 0 {
+		// Nobody is interested in the result anymore. Later callers start
+		// a new call instead of joining the canceled one.
+		c.cancel()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+	}
+	return nil, false, ctx.Err()
+}
+
+// detachedContext carries the values of its parent but not its deadline or
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
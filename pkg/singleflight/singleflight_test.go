@@ -0,0 +1,62 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDoLeaderCanceled(t *testing.T) {
+	var (
+		g       Group
+		calls   int
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	fn := func(ctx context.Context) (interface{}, error) {
+		calls++
+		close(started)
+		select {
+		case <-release:
+			return "result", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, _, err := g.Do(leaderCtx, "key", fn); err != context.Canceled {
+			t.Errorf("expected leader to be canceled, got %v", err)
+		}
+	}()
+	<-started
+
+	type result struct {
+		v      interface{}
+		shared bool
+		err    error
+	}
+	follower := make(chan result)
+	go func() {
+		v, shared, err := g.Do(context.Background(), "key", fn)
+		follower <- result{v, shared, err}
+	}()
+	// Give the follower time to join before canceling the leader.
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	close(release)
+
+	res := <-follower
+	if res.err != nil || res.v != "result" || !res.shared {
+		t.Fatalf("unexpected follower result %v", res)
+	}
+	if calls != 1 {
+		t.Fatalf("expected a single call, got %d", calls)
+	}
+}
@@ -0,0 +1,18 @@
+// Package tenant carries the tenant a query is run for in its context.
+package tenant
+
+import "context"
+
+type contextKey struct{}
+
+// WithID returns a copy of the context carrying the tenant ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ID of the context or an empty string if it
+// carries none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OpenTelemetry returns a Tracer starting spans in the given OpenTelemetry
+// tracer, to be set with SetTracer. The span context is propagated through
+// the returned contexts, so the spans nest like the opentracing ones.
+func OpenTelemetry(t trace.Tracer) Tracer {
+	return otelTracer{t: t}
+}
+
+type otelTracer struct {
+	t trace.Tracer
+}
+
+func (t otelTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	ctx, s := t.t.Start(ctx, name)
+	return ctx, otelSpan{s: s}
+}
+
+type otelSpan struct {
+	s trace.Span
+}
+
+func (s otelSpan) SetAttribute(key string, value interface{}) {
+	s.s.SetAttributes(otelAttribute(key, value))
+}
+
+func (s otelSpan) RecordError(err error) {
+	s.s.RecordError(err)
+	s.s.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.s.End()
+}
+
+// otelAttribute converts the attribute to its OpenTelemetry type. Values of
+// types without a counterpart are formatted as strings.
+func otelAttribute(key string, value interface{}) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
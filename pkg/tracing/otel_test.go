@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOpenTelemetry(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	SetTracer(OpenTelemetry(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("test")))
+	defer SetTracer(nil)
+
+	parent, ctx := StartSpan(context.Background(), "query")
+	child, _ := StartSpan(ctx, "remote_read")
+	child.SetAttribute("series", 3)
+	child.SetAttribute("endpoint", "http://a")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.Name() != "remote_read" || s.Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Fatalf("expected remote_read to be a child of query, got %s with parent %s", s.Name(), s.Parent().SpanID())
+	}
+	expected := []attribute.KeyValue{attribute.Int("series", 3), attribute.String("endpoint", "http://a")}
+	if attrs := s.Attributes(); len(attrs) != 2 || attrs[0] != expected[0] || attrs[1] != expected[1] {
+		t.Fatalf("expected attributes %v, got %v", expected, attrs)
+	}
+	if s.Status().Code != codes.Error || len(s.Events()) != 1 {
+		t.Fatalf("expected the error to be recorded, got %v and %v", s.Status(), s.Events())
+	}
+}
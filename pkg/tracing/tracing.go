@@ -0,0 +1,84 @@
+// Package tracing starts spans in the global opentracing tracer and, if
+// set, in an additional tracer such as an OpenTelemetry bridge.
+package tracing
+
+import (
+	"context"
+	"sync"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+// Span is a single operation within a trace.
+type Span interface {
+	// SetAttribute sets a key-value attribute on the span.
+	SetAttribute(key string, value interface{})
+	// RecordError marks the span as failed with the error.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
+
+// Tracer starts spans in a tracing system other than opentracing, whose
+// context is propagated through the returned context. OpenTelemetry returns
+// a Tracer for an OpenTelemetry tracer.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+var (
+	mtx    sync.RWMutex
+	tracer Tracer
+)
+
+// SetTracer sets the tracer spans are started in alongside the global
+// opentracing tracer. A nil tracer disables it.
+func SetTracer(t Tracer) {
+	mtx.Lock()
+	defer mtx.Unlock()
+	tracer = t
+}
+
+// StartSpan starts a span with the given name as a child of the spans of the
+// context.
+func StartSpan(ctx context.Context, name string) (Span, context.Context) {
+	otSpan, ctx := opentracing.StartSpanFromContext(ctx, name)
+	s := &span{ot: otSpan}
+
+	mtx.RLock()
+	t := tracer
+	mtx.RUnlock()
+	if t != nil {
+		ctx, s.ext = t.Start(ctx, name)
+	}
+	return s, ctx
+}
+
+// span fans out to an opentracing span and a span of the additional tracer.
+type span struct {
+	ot  opentracing.Span
+	ext Span
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	s.ot.SetTag(key, value)
+	if s.ext != nil {
+		s.ext.SetAttribute(key, value)
+	}
+}
+
+func (s *span) RecordError(err error) {
+	ext.Error.Set(s.ot, true)
+	s.ot.LogKV("error", err.Error())
+	if s.ext != nil {
+		s.ext.RecordError(err)
+	}
+}
+
+func (s *span) End() {
+	s.ot.Finish()
+	if s.ext != nil {
+		s.ext.End()
+	}
+}
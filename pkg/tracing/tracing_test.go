@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	s := &recordingSpan{name: name, attrs: map[string]interface{}{}}
+	t.spans = append(t.spans, s)
+	return ctx, s
+}
+
+type recordingSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *recordingSpan) RecordError(err error)                      { s.err = err }
+func (s *recordingSpan) End()                                       { s.ended = true }
+
+func TestStartSpan(t *testing.T) {
+	tr := &recordingTracer{}
+	SetTracer(tr)
+	defer SetTracer(nil)
+
+	span, _ := StartSpan(context.Background(), "remote_read")
+	span.SetAttribute("series", 3)
+	span.RecordError(errors.New("boom"))
+	span.End()
+
+	if len(tr.spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(tr.spans))
+	}
+	s := tr.spans[0]
+	if s.name != "remote_read" || s.attrs["series"] != 3 || s.err == nil || !s.ended {
+		t.Fatalf("unexpected span %+v", s)
+	}
+}
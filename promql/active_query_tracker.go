@@ -0,0 +1,198 @@
+package promql
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/tenant"
+)
+
+const (
+	// entrySize is the number of bytes reserved for a single query in the
+	// file of the ActiveQueryTracker.
+	entrySize = 1000
+	// activeQueriesFile is the name of the file of the ActiveQueryTracker.
+	activeQueriesFile = "queries.active"
+)
+
+// ActiveQuery is a query that is currently being executed.
+type ActiveQuery struct {
+	Query     string    `json:"query"`
+	Tenant    string    `json:"tenant,omitempty"`
+	StartTime time.Time `json:"startTime"`
+}
+
+// ActiveQueryTracker records the running queries in a file of fixed size, so
+// that the queries that were running when the process crashed can be logged
+// on the next start.
+type ActiveQueryTracker struct {
+	file    *os.File
+	logger  *log.Logger
+	slots   chan int
+	mtx     sync.Mutex
+	running map[int]ActiveQuery
+}
+
+// NewActiveQueryTracker creates the file for maxConcurrent queries in dir and
+// logs the queries left over in it by a previous process. A nil logger logs
+// to the standard logger.
+func NewActiveQueryTracker(dir string, maxConcurrent int, logger *log.Logger) (*ActiveQueryTracker, error) {
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	filename := filepath.Join(dir, activeQueriesFile)
+	logUnfinishedQueries(filename, logger)
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	content := make([]byte, 1+maxConcurrent*entrySize+1)
+	for i := range content {
+		content[i] = ' '
+	}
+	content[0] = '['
+	content[len(content)-1] = ']'
+	if _, err := f.WriteAt(content, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	t := &ActiveQueryTracker{
+		file:    f,
+		logger:  logger,
+		slots:   make(chan int, maxConcurrent),
+		running: map[int]ActiveQuery{},
+	}
+	for i := 0; i < maxConcurrent; i++ {
+		t.slots <- i
+	}
+	return t, nil
+}
+
+// logUnfinishedQueries logs the queries recorded in the file by a previous
+// process, which were still running when it exited.
+func logUnfinishedQueries(filename string, logger *log.Logger) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Printf("failed to read active query log %s: %v", filename, err)
+		}
+		return
+	}
+	s := strings.TrimRight(strings.TrimSpace(string(content)), "]")
+	s = strings.TrimRight(strings.TrimSpace(s), ",") + "]"
+
+	var queries []ActiveQuery
+	if err := json.Unmarshal([]byte(s), &queries); err != nil {
+		logger.Printf("failed to parse active query log %s: %v", filename, err)
+		return
+	}
+	if len(queries) == 0 {
+		return
+	}
+	logger.Printf("these queries did not finish before the last shutdown:")
+	for _, q := range queries {
+		logger.Printf("query=%q tenant=%q started=%s", q.Query, q.Tenant, q.StartTime.Format(time.RFC3339))
+	}
+}
+
+// Insert records the query as running and returns the index to delete it
+// with. It blocks until a slot in the file is free or the context is done.
+func (t *ActiveQueryTracker) Insert(ctx context.Context, query string) (int, error) {
+	select {
+	case i := <-t.slots:
+		aq := ActiveQuery{
+			Query:     query,
+			Tenant:    tenant.FromContext(ctx),
+			StartTime: time.Now(),
+		}
+		t.mtx.Lock()
+		t.running[i] = aq
+		t.mtx.Unlock()
+		t.write(i, encodeEntry(aq))
+		return i, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// Delete removes the query with the given index from the running queries.
+func (t *ActiveQueryTracker) Delete(i int) {
+	t.write(i, nil)
+	t.mtx.Lock()
+	delete(t.running, i)
+	t.mtx.Unlock()
+	t.slots <- i
+}
+
+// Queries returns the running queries ordered by their start time.
+func (t *ActiveQueryTracker) Queries() []ActiveQuery {
+	t.mtx.Lock()
+	queries := make([]ActiveQuery, 0, len(t.running))
+	for _, q := range t.running {
+		queries = append(queries, q)
+	}
+	t.mtx.Unlock()
+
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].StartTime.Before(queries[j].StartTime)
+	})
+	return queries
+}
+
+// Close closes the file of the tracker.
+func (t *ActiveQueryTracker) Close() error {
+	return t.file.Close()
+}
+
+// write writes the entry padded with spaces into the slot of the file.
+func (t *ActiveQueryTracker) write(i int, entry []byte) {
+	buf := make([]byte, entrySize)
+	n := copy(buf, entry)
+	for ; n < entrySize; n++ {
+		buf[n] = ' '
+	}
+	if _, err := t.file.WriteAt(buf, int64(1+i*entrySize)); err != nil {
+		t.logger.Printf("failed to write active query log: %v", err)
+	}
+}
+
+// encodeEntry encodes the query followed by a comma, shortening the query
+// string until the entry fits into a slot.
+func encodeEntry(q ActiveQuery) []byte {
+	for {
+		b, err := json.Marshal(q)
+		if err != nil {
+			return nil
+		}
+		if len(b) < entrySize {
+			return append(b, ',')
+		}
+		if q.Query == "" {
+			return nil
+		}
+		// Cut the query string by the overhang, as escaping may only make
+		// it longer.
+		cut := len(q.Query) - (len(b) - entrySize + 1)
+		if cut < 0 {
+			cut = 0
+		}
+		for cut > 0 && !utf8.RuneStart(q.Query[cut]) {
+			cut--
+		}
+		q.Query = q.Query[:cut]
+	}
+}
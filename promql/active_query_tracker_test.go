@@ -0,0 +1,55 @@
+package promql
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/tenant"
+)
+
+func TestActiveQueryTracker(t *testing.T) {
+	dir, err := ioutil.TempDir("", "active_queries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	tracker, err := NewActiveQueryTracker(dir, 2, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := tenant.WithID(context.Background(), "team-a")
+	i, err := tracker.Insert(ctx, `rate(http_requests_total[5m])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := tracker.Insert(ctx, strings.Repeat("x", 2*entrySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queries := tracker.Queries(); len(queries) != 2 || queries[0].Tenant != "team-a" {
+		t.Fatalf("unexpected running queries %v", queries)
+	}
+	tracker.Delete(j)
+	if _, err := tracker.Insert(ctx, "up"); err != nil {
+		t.Fatal(err)
+	}
+	tracker.Delete(i)
+	// Simulate a crash by not deleting the last query.
+	tracker.Close()
+
+	if _, err := NewActiveQueryTracker(dir, 2, logger); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, `query="up" tenant="team-a"`) || strings.Contains(out, "rate(") {
+		t.Fatalf("unexpected log output %q", out)
+	}
+}
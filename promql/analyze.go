@@ -0,0 +1,122 @@
+package promql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/storage"
+)
+
+// NodeProfile is the execution profile of an AST node and its children.
+type NodeProfile struct {
+	Node string `json:"node"`
+	Type string `json:"type"`
+	// Duration is the wall time spent evaluating the node, including its
+	// children. Range selectors evaluated by a function call are timed as
+	// part of the call.
+	Duration time.Duration `json:"duration"`
+	// Series and Points are the size of the output of the node.
+	Series int `json:"series"`
+	Points int `json:"points"`
+	// Samples is the number of samples read by the selectors of the node.
+	Samples  int            `json:"samples"`
+	Children []*NodeProfile `json:"children,omitempty"`
+}
+
+func newNodeProfile(node Node) *NodeProfile {
+	return &NodeProfile{
+		Node: node.String(),
+		Type: strings.Split(fmt.Sprintf("%T", node), ".")[1],
+	}
+}
+
+// addSelector adds the profile of a range selector evaluated as part of a
+// function call.
+func (p *NodeProfile) addSelector(sel *MatrixSelector, samples int) {
+	c := newNodeProfile(sel)
+	c.Series = len(sel.series)
+	c.Points = samples
+	c.Samples = samples
+	p.Children = append(p.Children, c)
+}
+
+// String renders the profile like Tree renders the expression.
+func (p *NodeProfile) String() string {
+	return p.tree("")
+}
+
+func (p *NodeProfile) tree(level string) string {
+	t := fmt.Sprintf("%s |---- %s :: %s [time=%s series=%d points=%d samples=%d]\n",
+		level, p.Type, p.Node, p.Duration, p.Series, p.Points, p.Samples)
+	level += " · · ·"
+	for _, c := range p.Children {
+		t += c.tree(level)
+	}
+	return t
+}
+
+type profileKey struct{}
+
+// WithProfile returns a copy of the context requesting a profile of the
+// queries executed with it, returned by Query.Profile.
+func WithProfile(ctx context.Context) context.Context {
+	return context.WithValue(ctx, profileKey{}, true)
+}
+
+func profileFromContext(ctx context.Context) bool {
+	profile, _ := ctx.Value(profileKey{}).(bool)
+	return profile
+}
+
+// profiledEval evaluates the expression as a child of the current profile.
+func (ev *evaluator) profiledEval(expr Expr) Value {
+	parent := ev.profile
+	p := newNodeProfile(expr)
+	parent.Children = append(parent.Children, p)
+	ev.profile = p
+	defer func() { ev.profile = parent }()
+
+	samples := ev.totalSamples
+	start := time.Now()
+	v := ev.evalExpr(expr)
+	p.Duration = time.Since(start)
+	p.Samples = ev.totalSamples - samples
+	switch v := v.(type) {
+	case Matrix:
+		p.Series = len(v)
+		p.Points = v.TotalSamples()
+	case Vector:
+		p.Series = len(v)
+		p.Points = len(v)
+	default:
+		p.Points = 1
+	}
+	return v
+}
+
+// ExplainAnalyze executes the query and returns its fetch plan together with
+// the profile of its execution.
+func (ng *Engine) ExplainAnalyze(ctx context.Context, q storage.Queryable, qs string, start, end time.Time, interval time.Duration) (*Explanation, error) {
+	e, err := Explain(q, qs, start, end, interval)
+	if err != nil {
+		return nil, err
+	}
+	var qry Query
+	if interval == 0 {
+		qry, err = ng.NewInstantQuery(q, qs, end)
+	} else {
+		qry, err = ng.NewRangeQuery(q, qs, start, end, interval)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer qry.Close()
+
+	if res := qry.Exec(WithProfile(ctx)); res.Err != nil {
+		return nil, res.Err
+	}
+	e.Profile = qry.Profile()
+	return e, nil
+}
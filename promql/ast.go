@@ -131,11 +131,29 @@ type MatrixSelector struct {
 	Range         time.Duration
 	Offset        time.Duration
 	LabelMatchers []*labels.Matcher
+	// Timestamp is the millisecond timestamp set by the @ modifier, if any.
+	Timestamp *int64
+	// StartOrEnd is set if the @ modifier uses start() or end().
+	StartOrEnd ItemType
 
 	// The series are populated at query preparation time.
 	series []storage.Series
 }
 
+// SubqueryExpr represents a subquery, the expression evaluated over the
+// range at the resolution of the step.
+type SubqueryExpr struct {
+	Expr   Expr
+	Range  time.Duration
+	Offset time.Duration
+	// Step is zero if the default resolution is used.
+	Step time.Duration
+	// Timestamp is the millisecond timestamp set by the @ modifier, if any.
+	Timestamp *int64
+	// StartOrEnd is set if the @ modifier uses start() or end().
+	StartOrEnd ItemType
+}
+
 // NumberLiteral represents a number.
 type NumberLiteral struct {
 	Val float64
@@ -164,6 +182,10 @@ type VectorSelector struct {
 	Name          string
 	Offset        time.Duration
 	LabelMatchers []*labels.Matcher
+	// Timestamp is the millisecond timestamp set by the @ modifier, if any.
+	Timestamp *int64
+	// StartOrEnd is set if the @ modifier uses start() or end().
+	StartOrEnd ItemType
 
 	// The series are populated at query preparation time.
 	series []storage.Series
@@ -175,6 +197,7 @@ func (e *MatrixSelector) Type() ValueType { return ValueTypeMatrix }
 func (e *NumberLiteral) Type() ValueType  { return ValueTypeScalar }
 func (e *ParenExpr) Type() ValueType      { return e.Expr.Type() }
 func (e *StringLiteral) Type() ValueType  { return ValueTypeString }
+func (e *SubqueryExpr) Type() ValueType   { return ValueTypeMatrix }
 func (e *UnaryExpr) Type() ValueType      { return e.Expr.Type() }
 func (e *VectorSelector) Type() ValueType { return ValueTypeVector }
 func (e *BinaryExpr) Type() ValueType {
@@ -191,6 +214,7 @@ func (*MatrixSelector) expr() {}
 func (*NumberLiteral) expr()  {}
 func (*ParenExpr) expr()      {}
 func (*StringLiteral) expr()  {}
+func (*SubqueryExpr) expr()   {}
 func (*UnaryExpr) expr()      {}
 func (*VectorSelector) expr() {}
 
@@ -307,6 +331,11 @@ func Walk(v Visitor, node Node, path []Node) error {
 			return err
 		}
 
+	case *SubqueryExpr:
+		if err := Walk(v, n.Expr, path); err != nil {
+			return err
+		}
+
 	case *UnaryExpr:
 		if err := Walk(v, n.Expr, path); err != nil {
 			return err
@@ -0,0 +1,218 @@
+package promql
+
+import (
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/timestamp"
+)
+
+// resolveStartEnd sets the timestamps of the @ start() and @ end() modifiers
+// in the expression to the start and end of the evaluation.
+func resolveStartEnd(expr Expr, start, end time.Time) {
+	resolve := func(startOrEnd ItemType) *int64 {
+		var ts int64
+		switch startOrEnd {
+		case itemStart:
+			ts = timestamp.FromTime(start)
+		case itemEnd:
+			ts = timestamp.FromTime(end)
+		default:
+			return nil
+		}
+		return &ts
+	}
+	Inspect(expr, func(node Node, _ []Node) error {
+		switch n := node.(type) {
+		case *VectorSelector:
+			if ts := resolve(n.StartOrEnd); ts != nil {
+				n.Timestamp = ts
+			}
+		case *MatrixSelector:
+			if ts := resolve(n.StartOrEnd); ts != nil {
+				n.Timestamp = ts
+			}
+		case *SubqueryExpr:
+			if ts := resolve(n.StartOrEnd); ts != nil {
+				n.Timestamp = ts
+			}
+		}
+		return nil
+	})
+}
+
+// UsesStartOrEnd reports whether the expression contains an @ start() or
+// @ end() modifier, in which case its result depends on the evaluated range
+// as a whole rather than on the individual steps.
+func UsesStartOrEnd(expr Expr) bool {
+	var found bool
+	Inspect(expr, func(node Node, _ []Node) error {
+		switch n := node.(type) {
+		case *VectorSelector:
+			found = found || n.StartOrEnd == itemStart || n.StartOrEnd == itemEnd
+		case *MatrixSelector:
+			found = found || n.StartOrEnd == itemStart || n.StartOrEnd == itemEnd
+		case *SubqueryExpr:
+			found = found || n.StartOrEnd == itemStart || n.StartOrEnd == itemEnd
+		}
+		return nil
+	})
+	return found
+}
+
+// PinnedUntil returns the latest time in milliseconds read by the selectors
+// of the expression that are pinned to a fixed time by an @ <timestamp>
+// modifier, and false if there are none. The result of the expression at any
+// step may change until data up to that time is complete.
+func PinnedUntil(expr Expr) (int64, bool) {
+	var (
+		until int64
+		found bool
+	)
+	Inspect(expr, func(node Node, path []Node) error {
+		switch n := node.(type) {
+		case *VectorSelector:
+			if n.StartOrEnd != 0 || (n.Timestamp == nil && !pinnedSubquery(path)) {
+				return nil
+			}
+		case *MatrixSelector:
+			if n.StartOrEnd != 0 || (n.Timestamp == nil && !pinnedSubquery(path)) {
+				return nil
+			}
+		default:
+			return nil
+		}
+		_, end := selectorTimes(&EvalStmt{}, node, path)
+		if !found || end > until {
+			until, found = end, true
+		}
+		return nil
+	})
+	return until, found
+}
+
+// Lookahead returns how far in milliseconds the selectors of the expression
+// that are not pinned by an @ modifier read past the evaluation time, which
+// is the largest negative offset among them. The result at a step may change
+// until data up to the step plus the lookahead is complete.
+func Lookahead(expr Expr) int64 {
+	var lookahead int64
+	s := &EvalStmt{Start: timestamp.Time(0), End: timestamp.Time(0)}
+	Inspect(expr, func(node Node, path []Node) error {
+		switch n := node.(type) {
+		case *VectorSelector:
+			if n.Timestamp != nil || pinnedSubquery(path) {
+				return nil
+			}
+		case *MatrixSelector:
+			if n.Timestamp != nil || pinnedSubquery(path) {
+				return nil
+			}
+		default:
+			return nil
+		}
+		if _, end := selectorTimes(s, node, path); end > lookahead {
+			lookahead = end
+		}
+		return nil
+	})
+	return lookahead
+}
+
+// pinnedSubquery reports whether a subquery on the path is pinned to a fixed
+// time by an @ <timestamp> modifier.
+func pinnedSubquery(path []Node) bool {
+	for _, node := range path {
+		if n, ok := node.(*SubqueryExpr); ok && n.Timestamp != nil && n.StartOrEnd == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isPinned reports whether the instant vector or scalar expression has the
+// same result at every step because all its selectors and subqueries are
+// pinned to a time by the @ modifier.
+func isPinned(expr Expr) bool {
+	if t := expr.Type(); t != ValueTypeVector && t != ValueTypeScalar {
+		return false
+	}
+	var pinned bool
+	invariant := stepInvariant(expr, &pinned)
+	return invariant && pinned
+}
+
+// stepInvariant reports whether the expression evaluates to the same result
+// at every step. pinned is set if an @ modifier is found.
+func stepInvariant(expr Expr, pinned *bool) bool {
+	switch e := expr.(type) {
+	case *VectorSelector:
+		*pinned = *pinned || e.Timestamp != nil
+		return e.Timestamp != nil
+	case *MatrixSelector:
+		*pinned = *pinned || e.Timestamp != nil
+		return e.Timestamp != nil
+	case *SubqueryExpr:
+		*pinned = *pinned || e.Timestamp != nil
+		return e.Timestamp != nil
+	case *NumberLiteral, *StringLiteral:
+		return true
+	case *ParenExpr:
+		return stepInvariant(e.Expr, pinned)
+	case *UnaryExpr:
+		return stepInvariant(e.Expr, pinned)
+	case *BinaryExpr:
+		lhs := stepInvariant(e.LHS, pinned)
+		return stepInvariant(e.RHS, pinned) && lhs
+	case *AggregateExpr:
+		if e.Param != nil && !stepInvariant(e.Param, pinned) {
+			return false
+		}
+		return stepInvariant(e.Expr, pinned)
+	case *Call:
+		// Functions without arguments, such as time(), depend on the
+		// evaluation time.
+		if len(e.Args) == 0 {
+			return false
+		}
+		for _, a := range e.Args {
+			if !stepInvariant(a, pinned) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// evalPinned evaluates a pinned expression once at the start of the range and
+// repeats the result at every step.
+func (ev *evaluator) evalPinned(expr Expr) Value {
+	newEv := *ev
+	newEv.endTimestamp = ev.startTimestamp
+	res := newEv.evalExpr(expr).(Matrix)
+	ev.currentSamples = newEv.currentSamples
+	ev.totalSamples = newEv.totalSamples
+	ev.peakSamples = newEv.peakSamples
+
+	numSteps := int((ev.endTimestamp-ev.startTimestamp)/ev.interval) + 1
+	for i := range res {
+		if len(res[i].Points) == 0 {
+			continue
+		}
+		v, h := res[i].Points[0].V, res[i].Points[0].H
+		points := getPointSlice(numSteps)
+		for ts := ev.startTimestamp; ts <= ev.endTimestamp; ts += ev.interval {
+			if ev.currentSamples >= ev.maxSamples {
+				ev.error(ErrTooManySamples(env))
+			}
+			points = append(points, Point{T: ts, V: v, H: h})
+			ev.currentSamples++
+		}
+		// The single point of the evaluation is accounted already.
+		ev.currentSamples--
+		putPointSlice(res[i].Points)
+		res[i].Points = points
+	}
+	ev.updatePeak()
+	return res
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"reflect"
 	"regexp"
 	"runtime"
 	"sort"
@@ -30,8 +31,13 @@ import (
 	"github.com/prometheus/common/model"
 
 	"github.com/lwangrabbit/promql-sdk/pkg/gate"
+	"github.com/lwangrabbit/promql-sdk/pkg/histogram"
 	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/pkg/scheduler"
+	"github.com/lwangrabbit/promql-sdk/pkg/singleflight"
+	"github.com/lwangrabbit/promql-sdk/pkg/tenant"
 	"github.com/lwangrabbit/promql-sdk/pkg/timestamp"
+	"github.com/lwangrabbit/promql-sdk/pkg/tracing"
 	"github.com/lwangrabbit/promql-sdk/pkg/value"
 	"github.com/lwangrabbit/promql-sdk/storage"
 	"github.com/lwangrabbit/promql-sdk/util/stats"
@@ -96,12 +102,22 @@ type Query interface {
 	Statement() Statement
 	// Stats returns statistics about the lifetime of the query.
 	Stats() *stats.QueryTimers
+	// SampleStats returns the detailed sample statistics of the query, nil
+	// unless requested with stats.WithDetailed.
+	SampleStats() *stats.QuerySamples
+	// Profile returns the execution profile of the query, nil unless
+	// requested with WithProfile.
+	Profile() *NodeProfile
 	// Cancel signals that a running query execution should be aborted.
 	Cancel()
+	// ID returns the ID of the query, unique within its engine.
+	ID() uint64
 }
 
 // query implements the Query interface.
 type query struct {
+	// ID of the query within its engine.
+	id uint64
 	// Underlying data provider.
 	queryable storage.Queryable
 	// The original query string.
@@ -112,8 +128,26 @@ type query struct {
 	stats *stats.QueryTimers
 	// Result matrix for reuse.
 	matrix Matrix
-	// Cancellation function for the query.
+	// Whether the query is the shared evaluation of coalesced queries,
+	// which is not registered as running itself as its callers are.
+	shared bool
+	// Cancellation function for the query, guarded by mtx as it may be
+	// called while the query is running.
+	mtx    sync.Mutex
 	cancel func()
+	// Limits of the tenant the query is run for.
+	limits Limits
+	// Number of samples and series loaded by the selectors.
+	samples, series int
+	// Remote endpoints read from, only recorded for the query log and the
+	// detailed stats.
+	endpoints *storage.Endpoints
+	// Detailed sample stats, if requested.
+	sampleStats *stats.QuerySamples
+	// Execution profile, if requested.
+	profile *NodeProfile
+	// Warnings raised during the evaluation.
+	warnings []string
 
 	// The engine against which the query is executed.
 	ng *Engine
@@ -129,13 +163,30 @@ func (q *query) Stats() *stats.QueryTimers {
 	return q.stats
 }
 
+// SampleStats implements the Query interface.
+func (q *query) SampleStats() *stats.QuerySamples {
+	return q.sampleStats
+}
+
+// Profile implements the Query interface.
+func (q *query) Profile() *NodeProfile {
+	return q.profile
+}
+
 // Cancel implements the Query interface.
 func (q *query) Cancel() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
 	if q.cancel != nil {
 		q.cancel()
 	}
 }
 
+// ID implements the Query interface.
+func (q *query) ID() uint64 {
+	return q.id
+}
+
 // Close implements the Query interface.
 func (q *query) Close() {
 	for _, s := range q.matrix {
@@ -149,8 +200,86 @@ func (q *query) Exec(ctx context.Context) *Result {
 		span.SetTag(queryTag, q.stmt.String())
 	}
 
+	if q.ng.coalesce {
+		if key, ok := q.flightKey(ctx); ok {
+			return q.execShared(ctx, key)
+		}
+	}
+
+	start := time.Now()
 	res, err := q.ng.exec(ctx, q)
-	return &Result{Err: err, Value: res}
+	q.ng.logQuery(ctx, q, start, err)
+	return &Result{Err: err, Value: res, Warnings: q.warnings}
+}
+
+// execShared executes the query once for all concurrent callers with the
+// same key. The evaluation runs on a copy of the query, as it may outlive
+// the caller that started it, and its stats are handed to all callers.
+// Every caller is registered as running under its own ID. Cancelling a
+// caller detaches it from the evaluation, which is only canceled once all
+// of its callers are.
+func (q *query) execShared(ctx context.Context, key string) *Result {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	q.mtx.Lock()
+	q.cancel = cancel
+	q.mtx.Unlock()
+	q.ng.register(ctx, q)
+	defer q.ng.deregister(q)
+
+	res, _, err := q.ng.flights.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		// The result is shared with other callers, so the points of the
+		// copy's matrix are never recycled.
+		shared := &query{
+			id:        q.ng.nextQueryID(),
+			queryable: q.queryable,
+			q:         q.q,
+			stmt:      q.stmt,
+			stats:     stats.NewQueryTimers(),
+			ng:        q.ng,
+			shared:    true,
+		}
+		start := time.Now()
+		val, err := q.ng.exec(ctx, shared)
+		q.ng.logQuery(ctx, shared, start, err)
+		return &sharedResult{val: val, stats: shared.stats, sampleStats: shared.sampleStats, profile: shared.profile, warnings: shared.warnings}, err
+	})
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return &Result{Err: contextErr(err, env)}
+	}
+	sr, ok := res.(*sharedResult)
+	if !ok {
+		return &Result{Err: err}
+	}
+	q.stats = sr.stats
+	q.sampleStats = sr.sampleStats
+	q.profile = sr.profile
+	q.warnings = sr.warnings
+	return &Result{Err: err, Value: sr.val, Warnings: sr.warnings}
+}
+
+// sharedResult is the result of an evaluation shared by several queries.
+type sharedResult struct {
+	val         Value
+	stats       *stats.QueryTimers
+	sampleStats *stats.QuerySamples
+	profile     *NodeProfile
+	warnings    []string
+}
+
+// flightKey returns the key identifying identical queries of a tenant and
+// priority against the same queryable, requesting the same stats. Only
+// evaluation statements against pointer queryables can be identified.
+func (q *query) flightKey(ctx context.Context) (string, bool) {
+	s, ok := q.stmt.(*EvalStmt)
+	if !ok {
+		return "", false
+	}
+	v := reflect.ValueOf(q.queryable)
+	if v.Kind() != reflect.Ptr {
+		return "", false
+	}
+	return fmt.Sprintf("%q:%d:%x:%s:%d:%d:%d:%t:%t", tenant.FromContext(ctx), scheduler.PriorityFromContext(ctx), v.Pointer(), s.Expr, timeMilliseconds(s.Start), timeMilliseconds(s.End), durationMilliseconds(s.Interval), stats.DetailedFromContext(ctx), profileFromContext(ctx)), true
 }
 
 // contextDone returns an error if the context was canceled or timed out.
@@ -180,6 +309,42 @@ type EngineOpts struct {
 	MaxConcurrent int
 	MaxSamples    int
 	Timeout       time.Duration
+
+	// CoalesceQueries makes concurrent identical queries against the same
+	// queryable share a single evaluation, its result and its stats. The
+	// shared result must not be modified.
+	CoalesceQueries bool
+
+	// Limits optionally returns the limits of the tenant a query is run
+	// for, overriding MaxSamples and Timeout.
+	Limits LimitsFunc
+
+	// ActiveQueryTracker optionally records the running queries. It should
+	// have room for MaxConcurrent queries.
+	ActiveQueryTracker *ActiveQueryTracker
+
+	// QueryLogger optionally logs the executed queries that took at least
+	// SlowQueryThreshold.
+	QueryLogger        QueryLogger
+	SlowQueryThreshold time.Duration
+
+	// Scheduler optionally replaces the FIFO gate limiting the concurrent
+	// queries with fair per-tenant queues. It should allow MaxConcurrent
+	// queries.
+	Scheduler *scheduler.Scheduler
+
+	// TraceNodes starts a span for every aggregation, function call and
+	// binary operation evaluated, in addition to the remote read and
+	// selector spans.
+	TraceNodes bool
+
+	// BucketInterpolation is the distribution assumed within histogram
+	// buckets by histogram_quantile and histogram_fraction.
+	BucketInterpolation BucketInterpolation
+
+	// Location is the default time zone of the date functions such as
+	// hour() and day_of_week(). Defaults to UTC.
+	Location *time.Location
 }
 
 // Engine handles the lifetime of queries from beginning to end.
@@ -188,7 +353,21 @@ type Engine struct {
 	metrics            *engineMetrics
 	timeout            time.Duration
 	gate               *gate.Gate
+	scheduler          *scheduler.Scheduler
 	maxSamplesPerQuery int
+	limitsFunc         LimitsFunc
+	activeQueryTracker *ActiveQueryTracker
+	queryLogger        QueryLogger
+	slowQueryThreshold time.Duration
+	coalesce           bool
+	traceNodes         bool
+	interpolation      BucketInterpolation
+	location           *time.Location
+	flights            singleflight.Group
+
+	lastQueryID    uint64
+	runningMtx     sync.Mutex
+	runningQueries map[uint64]*runningQuery
 }
 
 // NewEngine returns a new engine.
@@ -247,11 +426,24 @@ func NewEngine(opts EngineOpts) *Engine {
 			metrics.queryResultSort,
 		)
 	}
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
 	return &Engine{
 		gate:               gate.New(opts.MaxConcurrent),
+		scheduler:          opts.Scheduler,
 		timeout:            opts.Timeout,
 		metrics:            metrics,
 		maxSamplesPerQuery: opts.MaxSamples,
+		limitsFunc:         opts.Limits,
+		activeQueryTracker: opts.ActiveQueryTracker,
+		queryLogger:        opts.QueryLogger,
+		slowQueryThreshold: opts.SlowQueryThreshold,
+		traceNodes:         opts.TraceNodes,
+		interpolation:      opts.BucketInterpolation,
+		location:           opts.Location,
+		coalesce:           opts.CoalesceQueries,
+		runningQueries:     map[uint64]*runningQuery{},
 	}
 }
 
@@ -284,6 +476,7 @@ func (ng *Engine) NewRangeQuery(q storage.Queryable, qs string, start, end time.
 }
 
 func (ng *Engine) newQuery(q storage.Queryable, expr Expr, start, end time.Time, interval time.Duration) *query {
+	resolveStartEnd(expr, start, end)
 	es := &EvalStmt{
 		Expr:     expr,
 		Start:    start,
@@ -291,6 +484,7 @@ func (ng *Engine) newQuery(q storage.Queryable, expr Expr, start, end time.Time,
 		Interval: interval,
 	}
 	qry := &query{
+		id:        ng.nextQueryID(),
 		stmt:      es,
 		ng:        ng,
 		stats:     stats.NewQueryTimers(),
@@ -308,6 +502,7 @@ func (testStmt) stmt()          {}
 
 func (ng *Engine) newTestQuery(f func(context.Context) error) Query {
 	qry := &query{
+		id:    ng.nextQueryID(),
 		q:     "test statement",
 		stmt:  testStmt(f),
 		ng:    ng,
@@ -324,23 +519,52 @@ func (ng *Engine) exec(ctx context.Context, q *query) (Value, error) {
 	ng.metrics.currentQueries.Inc()
 	defer ng.metrics.currentQueries.Dec()
 
-	ctx, cancel := context.WithTimeout(ctx, ng.timeout)
+	q.limits = ng.limits(tenant.FromContext(ctx))
+	ctx, cancel := context.WithTimeout(ctx, q.limits.Timeout)
+	q.mtx.Lock()
 	q.cancel = cancel
+	q.mtx.Unlock()
+	if !q.shared {
+		ng.register(ctx, q)
+		defer ng.deregister(q)
+	}
+	if stats.DetailedFromContext(ctx) {
+		q.sampleStats = stats.NewQuerySamples()
+	}
+	if ng.queryLogger != nil || q.sampleStats != nil {
+		ctx, q.endpoints = storage.WithEndpoints(ctx)
+	}
 
 	execSpanTimer, ctx := q.stats.GetSpanTimer(ctx, stats.ExecTotalTime)
 	defer execSpanTimer.Finish()
 
 	queueSpanTimer, _ := q.stats.GetSpanTimer(ctx, stats.ExecQueueTime, ng.metrics.queryQueueTime)
 
-	if err := ng.gate.Start(ctx); err != nil {
-		return nil, contextErr(err, "query queue")
+	if ng.scheduler != nil {
+		err := ng.scheduler.Start(ctx, tenant.FromContext(ctx), scheduler.PriorityFromContext(ctx))
+		if err != nil {
+			return nil, contextErr(err, "query queue")
+		}
+		defer ng.scheduler.Done()
+	} else {
+		if err := ng.gate.Start(ctx); err != nil {
+			return nil, contextErr(err, "query queue")
+		}
+		defer ng.gate.Done()
 	}
-	defer ng.gate.Done()
 
 	queueSpanTimer.Finish()
 
+	if ng.activeQueryTracker != nil {
+		queryIndex, err := ng.activeQueryTracker.Insert(ctx, q.q)
+		if err != nil {
+			return nil, contextErr(err, "query queue")
+		}
+		defer ng.activeQueryTracker.Delete(queryIndex)
+	}
+
 	// Cancel when execution is done or an error was raised.
-	defer q.cancel()
+	defer cancel()
 
 	const env = "query execution"
 
@@ -354,7 +578,11 @@ func (ng *Engine) exec(ctx context.Context, q *query) (Value, error) {
 
 	switch s := q.Statement().(type) {
 	case *EvalStmt:
-		return ng.execEvalStmt(ctx, q, s)
+		val, err := ng.execEvalStmt(ctx, q, s)
+		if q.sampleStats != nil {
+			q.sampleStats.RemoteBytes = q.endpoints.Bytes()
+		}
+		return val, err
 	case testStmt:
 		return nil, s(ctx)
 	}
@@ -370,11 +598,42 @@ func durationMilliseconds(d time.Duration) int64 {
 	return int64(d / (time.Millisecond / time.Nanosecond))
 }
 
+// recordSamples records the sample statistics, the profile and the warnings
+// of the evaluator of the query.
+func (q *query) recordSamples(ev *evaluator) {
+	q.samples = ev.totalSamples
+	q.warnings = ev.warnings.list
+	if ev.profile != nil && len(ev.profile.Children) > 0 {
+		q.profile = ev.profile.Children[0]
+	}
+	if q.sampleStats == nil {
+		return
+	}
+	q.sampleStats.TotalSamples = ev.totalSamples
+	q.sampleStats.PeakSamples = ev.peakSamples
+	for i, n := range ev.samplesPerStep {
+		q.sampleStats.SamplesPerStep = append(q.sampleStats.SamplesPerStep, stats.StepSamples{
+			T: ev.startTimestamp + int64(i)*ev.interval,
+			V: n,
+		})
+	}
+}
+
 // execEvalStmt evaluates the expression of an evaluation statement for the given time range.
 func (ng *Engine) execEvalStmt(ctx context.Context, query *query, s *EvalStmt) (Value, error) {
+	if err := query.limits.checkRange(s); err != nil {
+		return nil, err
+	}
+
 	prepareSpanTimer, ctxPrepare := query.stats.GetSpanTimer(ctx, stats.QueryPreparationTime, ng.metrics.queryPrepareTime)
-	querier, err := ng.populateSeries(ctxPrepare, query.queryable, s)
+	querier, err := ng.populateSeries(ctxPrepare, query, s)
 	prepareSpanTimer.Finish()
+	if err != nil {
+		// Errors of canceled remote reads are reported as the cancellation.
+		if ctxErr := contextDone(ctx, "query preparation"); ctxErr != nil {
+			err = ctxErr
+		}
+	}
 
 	// XXX(fabxc): the querier returned by populateSeries might be instantiated
 	// we must not return without closing irrespective of the error.
@@ -396,9 +655,19 @@ func (ng *Engine) execEvalStmt(ctx context.Context, query *query, s *EvalStmt) (
 			endTimestamp:   start,
 			interval:       1,
 			ctx:            ctx,
-			maxSamples:     ng.maxSamplesPerQuery,
+			maxSamples:     query.limits.MaxSamples,
+			traceNodes:     ng.traceNodes,
+			interpolation:  ng.interpolation,
+			warnings:       &queryWarnings{},
+			location:       ng.location,
+
+			defaultEvalInterval: durationMilliseconds(SubqueryStep),
+		}
+		if profileFromContext(ctx) {
+			evaluator.profile = &NodeProfile{}
 		}
 		val, err := evaluator.Eval(s.Expr)
+		query.recordSamples(evaluator)
 		if err != nil {
 			return nil, err
 		}
@@ -410,6 +679,9 @@ func (ng *Engine) execEvalStmt(ctx context.Context, query *query, s *EvalStmt) (
 			panic(fmt.Errorf("promql.Engine.exec: invalid expression type %q", val.Type()))
 		}
 		query.matrix = mat
+		if err := query.limits.checkResult(mat); err != nil {
+			return nil, err
+		}
 		switch s.Expr.Type() {
 		case ValueTypeVector:
 			// Convert matrix with one value per series into vector.
@@ -417,7 +689,7 @@ func (ng *Engine) execEvalStmt(ctx context.Context, query *query, s *EvalStmt) (
 			for i, s := range mat {
 				// Point might have a different timestamp, force it to the evaluation
 				// timestamp as that is when we ran the evaluation.
-				vector[i] = Sample{Metric: s.Metric, Point: Point{V: s.Points[0].V, T: start}}
+				vector[i] = Sample{Metric: s.Metric, Point: Point{V: s.Points[0].V, H: s.Points[0].H, T: start}}
 			}
 			return vector, nil
 		case ValueTypeScalar:
@@ -436,9 +708,22 @@ func (ng *Engine) execEvalStmt(ctx context.Context, query *query, s *EvalStmt) (
 		endTimestamp:   timeMilliseconds(s.End),
 		interval:       durationMilliseconds(s.Interval),
 		ctx:            ctx,
-		maxSamples:     ng.maxSamplesPerQuery,
+		maxSamples:     query.limits.MaxSamples,
+		traceNodes:     ng.traceNodes,
+		interpolation:  ng.interpolation,
+		warnings:       &queryWarnings{},
+		location:       ng.location,
+
+		defaultEvalInterval: durationMilliseconds(s.Interval),
+	}
+	if profileFromContext(ctx) {
+		evaluator.profile = &NodeProfile{}
+	}
+	if query.sampleStats != nil {
+		evaluator.samplesPerStep = make([]int, (evaluator.endTimestamp-evaluator.startTimestamp)/evaluator.interval+1)
 	}
 	val, err := evaluator.Eval(s.Expr)
+	query.recordSamples(evaluator)
 	if err != nil {
 		return nil, err
 	}
@@ -449,6 +734,9 @@ func (ng *Engine) execEvalStmt(ctx context.Context, query *query, s *EvalStmt) (
 		panic(fmt.Errorf("promql.Engine.exec: invalid expression type %q", val.Type()))
 	}
 	query.matrix = mat
+	if err := query.limits.checkResult(mat); err != nil {
+		return nil, err
+	}
 
 	if err := contextDone(ctx, "expression evaluation"); err != nil {
 		return nil, err
@@ -463,80 +751,43 @@ func (ng *Engine) execEvalStmt(ctx context.Context, query *query, s *EvalStmt) (
 	return mat, nil
 }
 
-func (ng *Engine) populateSeries(ctx context.Context, q storage.Queryable, s *EvalStmt) (storage.Querier, error) {
-	var maxOffset time.Duration
-	Inspect(s.Expr, func(node Node, _ []Node) error {
-		switch n := node.(type) {
-		case *VectorSelector:
-			if maxOffset < LookbackDelta {
-				maxOffset = LookbackDelta
-			}
-			if n.Offset+LookbackDelta > maxOffset {
-				maxOffset = n.Offset + LookbackDelta
-			}
-		case *MatrixSelector:
-			if maxOffset < n.Range {
-				maxOffset = n.Range
-			}
-			if n.Offset+n.Range > maxOffset {
-				maxOffset = n.Offset + n.Range
-			}
-		}
-		return nil
-	})
-
-	mint := s.Start.Add(-maxOffset)
+func (ng *Engine) populateSeries(ctx context.Context, query *query, s *EvalStmt) (storage.Querier, error) {
+	mint, maxt := selectRange(s)
+	if err := query.limits.checkLookback(mint); err != nil {
+		return nil, err
+	}
 
-	querier, err := q.Querier(ctx, timestamp.FromTime(mint), timestamp.FromTime(s.End))
+	querier, err := query.queryable.Querier(ctx, timestamp.FromTime(mint), timestamp.FromTime(maxt))
 	if err != nil {
 		return nil, err
 	}
 
 	Inspect(s.Expr, func(node Node, path []Node) error {
-		var set storage.SeriesSet
-		params := &storage.SelectParams{
-			Start: timestamp.FromTime(s.Start),
-			End:   timestamp.FromTime(s.End),
-			Step:  int64(s.Interval / time.Millisecond),
-		}
-
 		switch n := node.(type) {
 		case *VectorSelector:
-			params.Start = params.Start - durationMilliseconds(LookbackDelta)
-			params.Func = extractFuncFromPath(path)
-			if n.Offset > 0 {
-				offsetMilliseconds := durationMilliseconds(n.Offset)
-				params.Start = params.Start - offsetMilliseconds
-				params.End = params.End - offsetMilliseconds
-			}
-
-			set, err = querier.Select(params, n.LabelMatchers...)
+			n.series, err = selectSeries(ctx, querier, n, selectParams(s, n, path), n.LabelMatchers)
 			if err != nil {
+				// TODO(fabxc): use multi-error.
 				return err
 			}
-			n.series, err = expandSeriesSet(ctx, set)
-			if err != nil {
-				// TODO(fabxc): use multi-error.
+			query.series += len(n.series)
+			if query.sampleStats != nil {
+				query.sampleStats.SeriesPerSelector[n.String()] += len(n.series)
+			}
+			if err = query.limits.checkSeries(n, len(n.series)); err != nil {
 				return err
 			}
 
 		case *MatrixSelector:
-			params.Func = extractFuncFromPath(path)
-			// For all matrix queries we want to ensure that we have (end-start) + range selected
-			// this way we have `range` data before the start time
-			params.Start = params.Start - durationMilliseconds(n.Range)
-			if n.Offset > 0 {
-				offsetMilliseconds := durationMilliseconds(n.Offset)
-				params.Start = params.Start - offsetMilliseconds
-				params.End = params.End - offsetMilliseconds
-			}
-
-			set, err = querier.Select(params, n.LabelMatchers...)
+			n.series, err = selectSeries(ctx, querier, n, selectParams(s, n, path), n.LabelMatchers)
 			if err != nil {
 				return err
 			}
-			n.series, err = expandSeriesSet(ctx, set)
-			if err != nil {
+			query.series += len(n.series)
+			if query.sampleStats != nil {
+				query.sampleStats.SeriesPerSelector[n.String()] += len(n.series)
+			}
+			if err = query.limits.checkSeries(n, len(n.series)); err != nil {
 				return err
 			}
 		}
@@ -545,6 +796,112 @@ func (ng *Engine) populateSeries(ctx context.Context, q storage.Queryable, s *Ev
 	return querier, err
 }
 
+// selectRange returns the time range the querier of the statement has to
+// cover, including the lookback and the ranges, offsets and @ modifiers of
+// its selectors.
+func selectRange(s *EvalStmt) (mint, maxt time.Time) {
+	start, end := timestamp.FromTime(s.Start), timestamp.FromTime(s.End)
+	Inspect(s.Expr, func(node Node, path []Node) error {
+		switch node.(type) {
+		case *VectorSelector, *MatrixSelector:
+			st, e := selectorTimes(s, node, path)
+			if st < start {
+				start = st
+			}
+			if e > end {
+				end = e
+			}
+		}
+		return nil
+	})
+	return timestamp.Time(start), timestamp.Time(end)
+}
+
+// selectorTimes returns the time range in milliseconds the vector or matrix
+// selector at the end of path reads samples from.
+func selectorTimes(s *EvalStmt, node Node, path []Node) (start, end int64) {
+	start, end = timestamp.FromTime(s.Start), timestamp.FromTime(s.End)
+
+	// Subqueries evaluate their expression over their range before the
+	// evaluation time, shifted by their offset.
+	subqOffset, subqRange, subqTs := subqueryTimes(path)
+	if subqTs != nil {
+		start, end = *subqTs, *subqTs
+	}
+
+	var (
+		ts          *int64
+		offset, rng time.Duration
+	)
+	switch n := node.(type) {
+	case *VectorSelector:
+		ts, offset, rng = n.Timestamp, n.Offset, LookbackDelta
+	case *MatrixSelector:
+		ts, offset, rng = n.Timestamp, n.Offset, n.Range
+	}
+	if ts != nil {
+		// The @ modifier of the selector overrides all evaluation times.
+		start, end = *ts, *ts
+	} else {
+		start -= durationMilliseconds(subqOffset + subqRange)
+		end -= durationMilliseconds(subqOffset)
+	}
+	start -= durationMilliseconds(offset + rng)
+	end -= durationMilliseconds(offset)
+	return start, end
+}
+
+// subqueryTimes returns the sum of the offsets and ranges of the subqueries
+// in the path and the timestamp of the innermost @ modifier among them.
+// The ranges and offsets of the subqueries enclosing that @ modifier do not
+// apply and are not included.
+func subqueryTimes(path []Node) (offset, rng time.Duration, ts *int64) {
+	for _, node := range path {
+		if n, ok := node.(*SubqueryExpr); ok {
+			if n.Timestamp != nil {
+				offset, rng, ts = 0, 0, n.Timestamp
+			}
+			offset += n.Offset
+			rng += n.Range
+		}
+	}
+	return offset, rng, ts
+}
+
+// selectParams returns the hints for selecting the series of the vector or
+// matrix selector at the end of path.
+func selectParams(s *EvalStmt, node Node, path []Node) *storage.SelectParams {
+	start, end := selectorTimes(s, node, path)
+	return &storage.SelectParams{
+		Start: start,
+		End:   end,
+		Step:  int64(s.Interval / time.Millisecond),
+		Func:  extractFuncFromPath(path),
+	}
+}
+
+// selectSeries selects and expands the series of a selector in its own span.
+func selectSeries(ctx context.Context, querier storage.Querier, n Node, params *storage.SelectParams, matchers []*labels.Matcher) (series []storage.Series, err error) {
+	span, ctx := tracing.StartSpan(ctx, "populate_series")
+	span.SetAttribute("selector", n.String())
+	span.SetAttribute("start", params.Start)
+	span.SetAttribute("end", params.End)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+		} else {
+			span.SetAttribute("series", len(series))
+		}
+		span.End()
+	}()
+
+	set, err := querier.Select(params, matchers...)
+	if err != nil {
+		return nil, err
+	}
+	return expandSeriesSet(ctx, set)
+}
+
 // extractFuncFromPath walks up the path and searches for the first instance of
 // a function or aggregation.
 func extractFuncFromPath(p []Node) string {
@@ -560,6 +917,10 @@ func extractFuncFromPath(p []Node) string {
 		// If we hit a binary expression we terminate since we only care about functions
 		// or aggregations over a single metric.
 		return ""
+	case *SubqueryExpr:
+		// Functions above a subquery are applied to its result rather than
+		// to the selected samples.
+		return ""
 	}
 	return extractFuncFromPath(p[:len(p)-1])
 }
@@ -588,6 +949,60 @@ type evaluator struct {
 
 	maxSamples     int
 	currentSamples int
+	// totalSamples is the number of samples loaded by selectors.
+	totalSamples int
+	// peakSamples is the highest value of currentSamples.
+	peakSamples int
+	// samplesPerStep optionally counts the samples loaded per step.
+	samplesPerStep []int
+	// profile is the profile of the node being evaluated, if profiling.
+	profile *NodeProfile
+	// defaultEvalInterval is the step of subqueries without one.
+	defaultEvalInterval int64
+	// interpolation is the distribution assumed within histogram buckets.
+	interpolation BucketInterpolation
+	// warnings collects the warnings of the evaluation. It is shared with
+	// the copies of the evaluator made for subqueries.
+	warnings *queryWarnings
+	// location is the default time zone of the date functions.
+	location *time.Location
+
+	traceNodes bool
+}
+
+// queryWarnings collects the distinct warnings raised during an evaluation
+// in the order they were first raised.
+type queryWarnings struct {
+	seen map[string]struct{}
+	list []string
+}
+
+func (w *queryWarnings) add(warning string) {
+	if w.seen == nil {
+		w.seen = map[string]struct{}{}
+	}
+	if _, ok := w.seen[warning]; ok {
+		return
+	}
+	w.seen[warning] = struct{}{}
+	w.list = append(w.list, warning)
+}
+
+// samplesLoaded accounts n samples loaded by a selector for the step at ts.
+func (ev *evaluator) samplesLoaded(ts int64, n int) {
+	ev.totalSamples += n
+	if ev.samplesPerStep != nil {
+		if i := (ts - ev.startTimestamp) / ev.interval; i >= 0 && i < int64(len(ev.samplesPerStep)) {
+			ev.samplesPerStep[i] += n
+		}
+	}
+}
+
+// updatePeak records the current number of samples if it is the highest yet.
+func (ev *evaluator) updatePeak() {
+	if ev.currentSamples > ev.peakSamples {
+		ev.peakSamples = ev.currentSamples
+	}
 }
 
 // errorf causes a panic with the input formatted into an error.
@@ -619,7 +1034,9 @@ func (ev *evaluator) recover(errp *error) {
 
 func (ev *evaluator) Eval(expr Expr) (v Value, err error) {
 	defer ev.recover(&err)
-	return ev.eval(expr), nil
+	v = ev.eval(expr)
+	ev.updatePeak()
+	return v, nil
 }
 
 // EvalNodeHelper stores extra information and caches for evaluating a single node across steps.
@@ -638,6 +1055,12 @@ type EvalNodeHelper struct {
 	signatureToMetricWithBuckets map[uint64]*metricWithBuckets
 	// label_replace.
 	regex *regexp.Regexp
+	// Distribution assumed within histogram buckets.
+	interpolation BucketInterpolation
+	// Warnings of the evaluation, if collected.
+	warnings *queryWarnings
+	// Default time zone and time zone argument of date functions.
+	location, tz *time.Location
 
 	// For binary vector matching.
 	rightSigs    map[uint64]Sample
@@ -645,6 +1068,13 @@ type EvalNodeHelper struct {
 	resultMetric map[uint64]labels.Labels
 }
 
+// warnf raises a warning of the evaluation.
+func (enh *EvalNodeHelper) warnf(format string, args ...interface{}) {
+	if enh.warnings != nil {
+		enh.warnings.add(fmt.Sprintf(format, args...))
+	}
+}
+
 // dropMetricName is a cached version of dropMetricName.
 func (enh *EvalNodeHelper) dropMetricName(l labels.Labels) labels.Labels {
 	if enh.dmn == nil {
@@ -712,7 +1142,7 @@ func (ev *evaluator) rangeEval(f func([]Value, *EvalNodeHelper) Vector, exprs ..
 			biggestLen = len(matrixes[i])
 		}
 	}
-	enh := &EvalNodeHelper{out: make(Vector, 0, biggestLen)}
+	enh := &EvalNodeHelper{out: make(Vector, 0, biggestLen), interpolation: ev.interpolation, warnings: ev.warnings, location: ev.location}
 	seriess := make(map[uint64]Series, biggestLen) // Output series by series hash.
 	tempNumSamples := ev.currentSamples
 	for ts := ev.startTimestamp; ts <= ev.endTimestamp; ts += ev.interval {
@@ -751,6 +1181,7 @@ func (ev *evaluator) rangeEval(f func([]Value, *EvalNodeHelper) Vector, exprs ..
 		// When we reset currentSamples to tempNumSamples during the next iteration of the loop it also
 		// needs to include the samples from the result here, as they're still in memory.
 		tempNumSamples += len(result)
+		ev.updatePeak()
 
 		if ev.currentSamples > ev.maxSamples {
 			ev.error(ErrTooManySamples(env))
@@ -796,6 +1227,7 @@ func (ev *evaluator) rangeEval(f func([]Value, *EvalNodeHelper) Vector, exprs ..
 		mat = append(mat, ss)
 	}
 	ev.currentSamples = originalNumSamples + mat.TotalSamples()
+	ev.updatePeak()
 	return mat
 }
 
@@ -806,6 +1238,31 @@ func (ev *evaluator) eval(expr Expr) Value {
 	if err := contextDone(ev.ctx, "expression evaluation"); err != nil {
 		ev.error(err)
 	}
+	if ev.traceNodes {
+		switch expr.(type) {
+		case *AggregateExpr, *Call, *BinaryExpr:
+			span, ctx := tracing.StartSpan(ev.ctx, "eval")
+			span.SetAttribute("node", expr.String())
+			parent := ev.ctx
+			ev.ctx = ctx
+			defer func() {
+				ev.ctx = parent
+				span.End()
+			}()
+		}
+	}
+	if ev.profile != nil {
+		return ev.profiledEval(expr)
+	}
+	return ev.evalExpr(expr)
+}
+
+// evalExpr evaluates the given expression as the given AST expression node
+// requires.
+func (ev *evaluator) evalExpr(expr Expr) Value {
+	if ev.startTimestamp != ev.endTimestamp && isPinned(expr) {
+		return ev.evalPinned(expr)
+	}
 	numSteps := int((ev.endTimestamp-ev.startTimestamp)/ev.interval) + 1
 
 	switch e := expr.(type) {
@@ -838,7 +1295,8 @@ func (ev *evaluator) eval(expr Expr) Value {
 
 		// Check if the function has a matrix argument.
 		var matrixArgIndex int
-		var matrixArg bool
+		var matrixArg, subqueryArg bool
+		args := e.Args
 		for i, a := range e.Args {
 			_, ok := a.(*MatrixSelector)
 			if ok {
@@ -846,10 +1304,28 @@ func (ev *evaluator) eval(expr Expr) Value {
 				matrixArg = true
 				break
 			}
+			// A subquery is evaluated up front and its result is then
+			// processed like the series of a range selector.
+			if subq, ok := a.(*SubqueryExpr); ok {
+				matrixArgIndex = i
+				matrixArg = true
+				subqueryArg = true
+				args = append(Expressions(nil), e.Args...)
+				args[i] = ev.subqueryAsSelector(subq)
+				break
+			}
 		}
+		acceptsHistograms := histogramFunctions[e.Func.Name]
 		if !matrixArg {
 			// Does not have a matrix argument.
 			return ev.rangeEval(func(v []Value, enh *EvalNodeHelper) Vector {
+				if !acceptsHistograms {
+					for i := range v {
+						if vec, ok := v[i].(Vector); ok {
+							v[i] = floatSamples(vec)
+						}
+					}
+				}
 				return e.Func.Call(v, e.Args, enh)
 			}, e.Args...)
 		}
@@ -866,7 +1342,7 @@ func (ev *evaluator) eval(expr Expr) Value {
 			}
 		}
 
-		sel := e.Args[matrixArgIndex].(*MatrixSelector)
+		sel := args[matrixArgIndex].(*MatrixSelector)
 		mat := make(Matrix, 0, len(sel.series)) // Output matrix.
 		offset := durationMilliseconds(sel.Offset)
 		selRange := durationMilliseconds(sel.Range)
@@ -878,9 +1354,19 @@ func (ev *evaluator) eval(expr Expr) Value {
 		points := getPointSlice(16)
 		inMatrix := make(Matrix, 1)
 		inArgs[matrixArgIndex] = inMatrix
-		enh := &EvalNodeHelper{out: make(Vector, 0, 1)}
+		enh := &EvalNodeHelper{out: make(Vector, 0, 1), interpolation: ev.interpolation, warnings: ev.warnings, location: ev.location}
 		// Process all the calls for one time series at a time.
 		it := storage.NewBuffer(selRange)
+		selSamples := ev.totalSamples
+		if subqueryArg {
+			// The samples of a subquery were accounted when it was evaluated.
+			perStep := ev.samplesPerStep
+			ev.samplesPerStep = nil
+			defer func() {
+				ev.totalSamples = selSamples
+				ev.samplesPerStep = perStep
+			}()
+		}
 		for i, s := range sel.series {
 			points = points[:0]
 			it.Reset(s.Iterator())
@@ -903,19 +1389,29 @@ func (ev *evaluator) eval(expr Expr) Value {
 					}
 				}
 				maxt := ts - offset
+				if sel.Timestamp != nil {
+					// All steps select the same range, which is hence
+					// loaded anew.
+					maxt = *sel.Timestamp - offset
+					points = points[:0]
+					it.Reset(s.Iterator())
+				}
 				mint := maxt - selRange
 				// Evaluate the matrix selector for this series for this step.
-				points = ev.matrixIterSlice(it, mint, maxt, points)
+				points = ev.matrixIterSlice(it, ts, mint, maxt, points)
+				if !acceptsHistograms {
+					points = floatPoints(points)
+				}
 				if len(points) == 0 {
 					continue
 				}
 				inMatrix[0].Points = points
 				enh.ts = ts
 				// Make the function call.
-				outVec := e.Func.Call(inArgs, e.Args, enh)
+				outVec := e.Func.Call(inArgs, args, enh)
 				enh.out = outVec[:0]
 				if len(outVec) > 0 {
-					ss.Points = append(ss.Points, Point{V: outVec[0].Point.V, T: ts})
+					ss.Points = append(ss.Points, Point{V: outVec[0].Point.V, H: outVec[0].Point.H, T: ts})
 				}
 				// Only buffer stepRange milliseconds from the second step on.
 				it.ReduceDelta(stepRange)
@@ -929,16 +1425,50 @@ func (ev *evaluator) eval(expr Expr) Value {
 				}
 			}
 		}
+		if ev.profile != nil && !subqueryArg {
+			ev.profile.addSelector(sel, ev.totalSamples-selSamples)
+		}
+		putPointSlice(points)
+
+		if e.Func.Name == "absent_over_time" {
+			return ev.absentOverTime(mat, e.Args[matrixArgIndex])
+		}
 		if mat.ContainsSameLabelset() {
 			ev.errorf("vector cannot contain metrics with the same labelset")
 		}
-
-		putPointSlice(points)
 		return mat
 
 	case *ParenExpr:
 		return ev.eval(e.Expr)
 
+	case *SubqueryExpr:
+		offsetMillis := durationMilliseconds(e.Offset)
+		rangeMillis := durationMilliseconds(e.Range)
+		newEv := *ev
+		if e.Timestamp != nil {
+			newEv.startTimestamp, newEv.endTimestamp = *e.Timestamp, *e.Timestamp
+		}
+		startTimestamp := newEv.startTimestamp
+		newEv.endTimestamp -= offsetMillis
+		if e.Step != 0 {
+			newEv.interval = durationMilliseconds(e.Step)
+		} else {
+			newEv.interval = ev.defaultEvalInterval
+		}
+		// Start with the first timestamp after (ev.startTimestamp - offset - range)
+		// that is aligned with the step (multiple of 'newEv.interval').
+		newEv.startTimestamp = newEv.interval * ((startTimestamp - offsetMillis - rangeMillis) / newEv.interval)
+		if newEv.startTimestamp < (startTimestamp - offsetMillis - rangeMillis) {
+			newEv.startTimestamp += newEv.interval
+		}
+		// The steps of the subquery are not the steps of the query.
+		newEv.samplesPerStep = nil
+		res := newEv.eval(e.Expr)
+		ev.currentSamples = newEv.currentSamples
+		ev.totalSamples = newEv.totalSamples
+		ev.peakSamples = newEv.peakSamples
+		return res
+
 	case *UnaryExpr:
 		mat := ev.eval(e.Expr).(Matrix)
 		if e.Op == itemSUB {
@@ -946,6 +1476,9 @@ func (ev *evaluator) eval(expr Expr) Value {
 				mat[i].Metric = dropMetricName(mat[i].Metric)
 				for j := range mat[i].Points {
 					mat[i].Points[j].V = -mat[i].Points[j].V
+					if h := mat[i].Points[j].H; h != nil {
+						mat[i].Points[j].H = h.Copy().Mul(-1)
+					}
 				}
 			}
 			if mat.ContainsSameLabelset() {
@@ -1008,11 +1541,12 @@ func (ev *evaluator) eval(expr Expr) Value {
 			}
 
 			for ts := ev.startTimestamp; ts <= ev.endTimestamp; ts += ev.interval {
-				_, v, ok := ev.vectorSelectorSingle(it, e, ts)
+				_, v, h, ok := ev.vectorSelectorSingle(it, e, ts)
 				if ok {
 					if ev.currentSamples < ev.maxSamples {
-						ss.Points = append(ss.Points, Point{V: v, T: ts})
+						ss.Points = append(ss.Points, Point{V: v, H: h, T: ts})
 						ev.currentSamples++
+						ev.samplesLoaded(ts, 1)
 					} else {
 						ev.error(ErrTooManySamples(env))
 					}
@@ -1036,6 +1570,33 @@ func (ev *evaluator) eval(expr Expr) Value {
 	panic(fmt.Errorf("unhandled expression of type: %T", expr))
 }
 
+// absentOverTime returns a series with a value of 1 at the steps at which
+// none of the series of mat, the result of present_over_time for arg, has a
+// point.
+func (ev *evaluator) absentOverTime(mat Matrix, arg Expr) Matrix {
+	numSteps := int((ev.endTimestamp-ev.startTimestamp)/ev.interval) + 1
+	found := make(map[int64]struct{}, numSteps)
+	for _, s := range mat {
+		for _, p := range s.Points {
+			found[p.T] = struct{}{}
+		}
+		ev.currentSamples -= len(s.Points)
+		putPointSlice(s.Points)
+	}
+	if len(found) == numSteps {
+		return Matrix{}
+	}
+
+	points := getPointSlice(numSteps - len(found))
+	for ts := ev.startTimestamp; ts <= ev.endTimestamp; ts += ev.interval {
+		if _, ok := found[ts]; !ok {
+			points = append(points, Point{T: ts, V: 1})
+		}
+	}
+	ev.currentSamples += len(points)
+	return Matrix{Series{Metric: absentLabels(arg), Points: points}}
+}
+
 // vectorSelector evaluates a *VectorSelector expression.
 func (ev *evaluator) vectorSelector(node *VectorSelector, ts int64) Vector {
 	var (
@@ -1046,13 +1607,14 @@ func (ev *evaluator) vectorSelector(node *VectorSelector, ts int64) Vector {
 	for i, s := range node.series {
 		it.Reset(s.Iterator())
 
-		t, v, ok := ev.vectorSelectorSingle(it, node, ts)
+		t, v, h, ok := ev.vectorSelectorSingle(it, node, ts)
 		if ok {
 			vec = append(vec, Sample{
 				Metric: node.series[i].Labels(),
-				Point:  Point{V: v, T: t},
+				Point:  Point{V: v, H: h, T: t},
 			})
 			ev.currentSamples++
+			ev.samplesLoaded(ts, 1)
 		}
 
 		if ev.currentSamples >= ev.maxSamples {
@@ -1063,10 +1625,14 @@ func (ev *evaluator) vectorSelector(node *VectorSelector, ts int64) Vector {
 }
 
 // vectorSelectorSingle evaluates a instant vector for the iterator of one time series.
-func (ev *evaluator) vectorSelectorSingle(it *storage.BufferedSeriesIterator, node *VectorSelector, ts int64) (int64, float64, bool) {
+func (ev *evaluator) vectorSelectorSingle(it *storage.BufferedSeriesIterator, node *VectorSelector, ts int64) (int64, float64, *histogram.FloatHistogram, bool) {
+	if node.Timestamp != nil {
+		ts = *node.Timestamp
+	}
 	refTime := ts - durationMilliseconds(node.Offset)
 	var t int64
 	var v float64
+	var h *histogram.FloatHistogram
 
 	ok := it.Seek(refTime)
 	if !ok {
@@ -1077,18 +1643,19 @@ func (ev *evaluator) vectorSelectorSingle(it *storage.BufferedSeriesIterator, no
 
 	if ok {
 		t, v = it.Values()
+		_, h = it.AtHistogram()
 	}
 
 	if !ok || t > refTime {
-		t, v, ok = it.PeekBack(1)
+		t, v, h, ok = it.PeekBack(1)
 		if !ok || t < refTime-durationMilliseconds(LookbackDelta) {
-			return 0, 0, false
+			return 0, 0, nil, false
 		}
 	}
-	if value.IsStaleNaN(v) {
-		return 0, 0, false
+	if h == nil && value.IsStaleNaN(v) {
+		return 0, 0, nil, false
 	}
-	return t, v, true
+	return t, v, h, true
 }
 
 var pointPool = sync.Pool{}
@@ -1105,11 +1672,80 @@ func putPointSlice(p []Point) {
 	pointPool.Put(p[:0])
 }
 
+// subqueryAsSelector evaluates the subquery and returns a range selector over
+// its result.
+func (ev *evaluator) subqueryAsSelector(subq *SubqueryExpr) *MatrixSelector {
+	mat := ev.eval(subq).(Matrix)
+	series := make([]storage.Series, 0, len(mat))
+	for _, s := range mat {
+		series = append(series, &storageSeries{series: s})
+	}
+	return &MatrixSelector{
+		Range:     subq.Range,
+		Offset:    subq.Offset,
+		Timestamp: subq.Timestamp,
+		series:    series,
+	}
+}
+
+// storageSeries makes an evaluated Series usable as a storage.Series.
+type storageSeries struct {
+	series Series
+}
+
+func (s *storageSeries) Labels() labels.Labels {
+	return s.series.Metric
+}
+
+func (s *storageSeries) Iterator() storage.SeriesIterator {
+	return &storageSeriesIterator{points: s.series.Points, curr: -1}
+}
+
+type storageSeriesIterator struct {
+	points []Point
+	curr   int
+}
+
+func (it *storageSeriesIterator) Seek(t int64) bool {
+	if it.curr < 0 {
+		it.curr = 0
+	}
+	for ; it.curr < len(it.points); it.curr++ {
+		if it.points[it.curr].T >= t {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *storageSeriesIterator) At() (int64, float64) {
+	p := it.points[it.curr]
+	return p.T, p.V
+}
+
+func (it *storageSeriesIterator) AtHistogram() (int64, *histogram.FloatHistogram) {
+	p := it.points[it.curr]
+	return p.T, p.H
+}
+
+func (it *storageSeriesIterator) Next() bool {
+	it.curr++
+	return it.curr < len(it.points)
+}
+
+func (it *storageSeriesIterator) Err() error {
+	return nil
+}
+
 // matrixSelector evaluates a *MatrixSelector expression.
 func (ev *evaluator) matrixSelector(node *MatrixSelector) Matrix {
+	ts := ev.startTimestamp
+	if node.Timestamp != nil {
+		ts = *node.Timestamp
+	}
 	var (
 		offset = durationMilliseconds(node.Offset)
-		maxt   = ev.startTimestamp - offset
+		maxt   = ts - offset
 		mint   = maxt - durationMilliseconds(node.Range)
 		matrix = make(Matrix, 0, len(node.series))
 		err    error
@@ -1125,7 +1761,7 @@ func (ev *evaluator) matrixSelector(node *MatrixSelector) Matrix {
 			Metric: node.series[i].Labels(),
 		}
 
-		ss.Points = ev.matrixIterSlice(it, mint, maxt, getPointSlice(16))
+		ss.Points = ev.matrixIterSlice(it, ev.startTimestamp, mint, maxt, getPointSlice(16))
 
 		if len(ss.Points) > 0 {
 			matrix = append(matrix, ss)
@@ -1144,7 +1780,10 @@ func (ev *evaluator) matrixSelector(node *MatrixSelector) Matrix {
 // values). Any such points falling before mint are discarded; points that fall
 // into the [mint, maxt] range are retained; only points with later timestamps
 // are populated from the iterator.
-func (ev *evaluator) matrixIterSlice(it *storage.BufferedSeriesIterator, mint, maxt int64, out []Point) []Point {
+//
+// The newly loaded samples are accounted to the step at ts.
+func (ev *evaluator) matrixIterSlice(it *storage.BufferedSeriesIterator, ts, mint, maxt int64, out []Point) []Point {
+	var loaded int
 	if len(out) > 0 && out[len(out)-1].T >= mint {
 		// There is an overlap between previous and current ranges, retain common
 		// points. In most such cases:
@@ -1172,7 +1811,8 @@ func (ev *evaluator) matrixIterSlice(it *storage.BufferedSeriesIterator, mint, m
 	buf := it.Buffer()
 	for buf.Next() {
 		t, v := buf.At()
-		if value.IsStaleNaN(v) {
+		h := storage.HistogramAt(buf)
+		if h == nil && value.IsStaleNaN(v) {
 			continue
 		}
 		// Values in the buffer are guaranteed to be smaller than maxt.
@@ -1180,21 +1820,25 @@ func (ev *evaluator) matrixIterSlice(it *storage.BufferedSeriesIterator, mint, m
 			if ev.currentSamples >= ev.maxSamples {
 				ev.error(ErrTooManySamples(env))
 			}
-			out = append(out, Point{T: t, V: v})
+			out = append(out, Point{T: t, V: v, H: h})
 			ev.currentSamples++
+			loaded++
 		}
 	}
 	// The seeked sample might also be in the range.
 	if ok {
 		t, v := it.Values()
-		if t == maxt && !value.IsStaleNaN(v) {
+		_, h := it.AtHistogram()
+		if t == maxt && (h != nil || !value.IsStaleNaN(v)) {
 			if ev.currentSamples >= ev.maxSamples {
 				ev.error(ErrTooManySamples(env))
 			}
-			out = append(out, Point{T: t, V: v})
+			out = append(out, Point{T: t, V: v, H: h})
 			ev.currentSamples++
+			loaded++
 		}
 	}
+	ev.samplesLoaded(ts, loaded)
 	return out
 }
 
@@ -1318,12 +1962,20 @@ func (ev *evaluator) VectorBinop(op ItemType, lhs, rhs Vector, matching *VectorM
 		}
 
 		// Account for potentially swapped sidedness.
-		vl, vr := ls.V, rs.V
+		pl, pr := ls.Point, rs.Point
 		if matching.Card == CardOneToMany {
-			vl, vr = vr, vl
+			pl, pr = pr, pl
 		}
-		value, keep := vectorElemBinop(op, vl, vr)
-		if returnBool {
+		var (
+			value float64
+			h     *histogram.FloatHistogram
+			keep  bool
+		)
+		if pl.H != nil || pr.H != nil {
+			if h, keep = histogramBinop(op, pl, pr); !keep {
+				continue
+			}
+		} else if value, keep = vectorElemBinop(op, pl.V, pr.V); returnBool {
 			if keep {
 				value = 1.0
 			} else {
@@ -1357,7 +2009,7 @@ func (ev *evaluator) VectorBinop(op ItemType, lhs, rhs Vector, matching *VectorM
 
 		enh.out = append(enh.out, Sample{
 			Metric: metric,
-			Point:  Point{V: value},
+			Point:  Point{V: value, H: h},
 		})
 	}
 	return enh.out
@@ -1429,6 +2081,22 @@ func resultMetric(lhs, rhs labels.Labels, op ItemType, matching *VectorMatching,
 // VectorscalarBinop evaluates a binary operation between a Vector and a Scalar.
 func (ev *evaluator) VectorscalarBinop(op ItemType, lhs Vector, rhs Scalar, swap, returnBool bool, enh *EvalNodeHelper) Vector {
 	for _, lhsSample := range lhs {
+		if lhsSample.H != nil {
+			lp, rp := lhsSample.Point, Point{T: rhs.T, V: rhs.V}
+			if swap {
+				lp, rp = rp, lp
+			}
+			h, keep := histogramBinop(op, lp, rp)
+			if !keep {
+				continue
+			}
+			lhsSample.H = h
+			if shouldDropMetricName(op) {
+				lhsSample.Metric = enh.dropMetricName(lhsSample.Metric)
+			}
+			enh.out = append(enh.out, lhsSample)
+			continue
+		}
 		lv, rv := lhsSample.V, rhs.V
 		// lhs always contains the Vector. If the original position was different
 		// swap for calculating the value.
@@ -1474,6 +2142,8 @@ func scalarBinop(op ItemType, lhs, rhs float64) float64 {
 		return math.Pow(lhs, rhs)
 	case itemMOD:
 		return math.Mod(lhs, rhs)
+	case itemATAN2:
+		return math.Atan2(lhs, rhs)
 	case itemEQL:
 		return btos(lhs == rhs)
 	case itemNEQ:
@@ -1505,6 +2175,8 @@ func vectorElemBinop(op ItemType, lhs, rhs float64) (float64, bool) {
 		return math.Pow(lhs, rhs), true
 	case itemMOD:
 		return math.Mod(lhs, rhs), true
+	case itemATAN2:
+		return math.Atan2(lhs, rhs), true
 	case itemEQL:
 		return lhs, lhs == rhs
 	case itemNEQ:
@@ -1521,6 +2193,31 @@ func vectorElemBinop(op ItemType, lhs, rhs float64) (float64, bool) {
 	panic(fmt.Errorf("operator %q not allowed for operations between Vectors", op))
 }
 
+// histogramBinop evaluates a binary operation of which at least one side is a
+// histogram. Histograms can be added to and subtracted from each other and be
+// multiplied and divided by floats, all other operations drop the sample.
+func histogramBinop(op ItemType, lhs, rhs Point) (*histogram.FloatHistogram, bool) {
+	switch {
+	case lhs.H != nil && rhs.H != nil:
+		switch op {
+		case itemADD:
+			return lhs.H.Copy().Add(rhs.H), true
+		case itemSUB:
+			return lhs.H.Copy().Sub(rhs.H), true
+		}
+	case lhs.H != nil:
+		switch op {
+		case itemMUL:
+			return lhs.H.Copy().Mul(rhs.V), true
+		case itemDIV:
+			return lhs.H.Copy().Div(rhs.V), true
+		}
+	case op == itemMUL:
+		return rhs.H.Copy().Mul(lhs.V), true
+	}
+	return nil, false
+}
+
 // intersection returns the metric of common label/value pairs of two input metrics.
 func intersection(ls1, ls2 labels.Labels) labels.Labels {
 	res := make(labels.Labels, 0, 5)
@@ -1543,14 +2240,41 @@ type groupedAggregation struct {
 	groupCount  int
 	heap        vectorByValueHeap
 	reverseHeap vectorByReverseValueHeap
+	// The sum of the histograms of sum and avg aggregations. A group with
+	// both floats and histograms has no result.
+	histogram *histogram.FloatHistogram
+	hasFloat  bool
+}
+
+// addHistogram adds h to the histogram sum of the group.
+func (g *groupedAggregation) addHistogram(h *histogram.FloatHistogram) {
+	if g.histogram == nil {
+		g.histogram = h.Copy()
+		return
+	}
+	g.histogram.Add(h)
+}
+
+// aggregatesHistograms reports whether the aggregation operator accepts
+// histogram samples. Histogram samples are ignored by all other operators.
+// The operators selecting series pass them through unchanged.
+func aggregatesHistograms(op ItemType) bool {
+	switch op {
+	case itemSum, itemAvg, itemCount, itemGroup, itemLimitK, itemLimitRatio:
+		return true
+	}
+	return false
 }
 
 // aggregation evaluates an aggregation operation on a Vector.
 func (ev *evaluator) aggregation(op ItemType, grouping []string, without bool, param interface{}, vec Vector, enh *EvalNodeHelper) Vector {
 
 	result := map[uint64]*groupedAggregation{}
+	if op == itemLimitRatio {
+		return ev.limitRatio(param.(float64), vec, enh)
+	}
 	var k int64
-	if op == itemTopK || op == itemBottomK {
+	if op == itemTopK || op == itemBottomK || op == itemLimitK {
 		f := param.(float64)
 		if !convertibleToInt64(f) {
 			ev.errorf("Scalar value %v overflows int64", f)
@@ -1576,6 +2300,9 @@ func (ev *evaluator) aggregation(op ItemType, grouping []string, without bool, p
 	}
 
 	for _, s := range vec {
+		if s.H != nil && !aggregatesHistograms(op) {
+			continue
+		}
 		metric := s.Metric
 
 		if op == itemCountValues {
@@ -1620,6 +2347,10 @@ func (ev *evaluator) aggregation(op ItemType, grouping []string, without bool, p
 				value:      s.V,
 				mean:       s.V,
 				groupCount: 1,
+				hasFloat:   s.H == nil,
+			}
+			if s.H != nil && (op == itemSum || op == itemAvg) {
+				result[groupingKey].addHistogram(s.H)
 			}
 			inputVecLen := int64(len(vec))
 			resultSize := k
@@ -1628,6 +2359,10 @@ func (ev *evaluator) aggregation(op ItemType, grouping []string, without bool, p
 			}
 			if op == itemStdvar || op == itemStddev {
 				result[groupingKey].value = 0.0
+			} else if op == itemGroup {
+				result[groupingKey].value = 1
+			} else if op == itemLimitK {
+				result[groupingKey].heap = vectorByValueHeap{s}
 			} else if op == itemTopK || op == itemQuantile {
 				result[groupingKey].heap = make(vectorByValueHeap, 0, resultSize)
 				heap.Push(&result[groupingKey].heap, &Sample{
@@ -1646,10 +2381,20 @@ func (ev *evaluator) aggregation(op ItemType, grouping []string, without bool, p
 
 		switch op {
 		case itemSum:
+			if s.H != nil {
+				group.addHistogram(s.H)
+				break
+			}
+			group.hasFloat = true
 			group.value += s.V
 
 		case itemAvg:
 			group.groupCount++
+			if s.H != nil {
+				group.addHistogram(s.H)
+				break
+			}
+			group.hasFloat = true
 			group.mean += (s.V - group.mean) / float64(group.groupCount)
 
 		case itemMax:
@@ -1693,9 +2438,12 @@ func (ev *evaluator) aggregation(op ItemType, grouping []string, without bool, p
 				})
 			}
 
-		case itemQuantile:
+		case itemQuantile, itemLimitK:
 			group.heap = append(group.heap, s)
 
+		case itemGroup:
+			// The value is always 1.
+
 		default:
 			panic(fmt.Errorf("expected aggregation operator but got %q", op))
 		}
@@ -1703,8 +2451,14 @@ func (ev *evaluator) aggregation(op ItemType, grouping []string, without bool, p
 
 	// Construct the result Vector from the aggregated groups.
 	for _, aggr := range result {
+		if aggr.histogram != nil && aggr.hasFloat {
+			continue
+		}
 		switch op {
 		case itemAvg:
+			if aggr.histogram != nil {
+				aggr.histogram.Div(float64(aggr.groupCount))
+			}
 			aggr.value = aggr.mean
 
 		case itemCount, itemCountValues:
@@ -1738,6 +2492,10 @@ func (ev *evaluator) aggregation(op ItemType, grouping []string, without bool, p
 			}
 			continue // Bypass default append.
 
+		case itemLimitK:
+			enh.out = append(enh.out, limitSeries(k, Vector(aggr.heap))...)
+			continue // Bypass default append.
+
 		case itemQuantile:
 			aggr.value = quantile(q, aggr.heap)
 
@@ -1747,12 +2505,56 @@ func (ev *evaluator) aggregation(op ItemType, grouping []string, without bool, p
 
 		enh.out = append(enh.out, Sample{
 			Metric: aggr.labels,
-			Point:  Point{V: aggr.value},
+			Point:  Point{V: aggr.value, H: aggr.histogram},
 		})
 	}
 	return enh.out
 }
 
+// limitSeries returns the k series of vec with the lowest hash of their
+// labels. The selection hence only depends on the series present and is
+// stable across the steps of a range query.
+func limitSeries(k int64, vec Vector) Vector {
+	if int64(len(vec)) <= k {
+		return vec
+	}
+	hashes := make([]uint64, len(vec))
+	idx := make([]int, len(vec))
+	for i, s := range vec {
+		hashes[i] = s.Metric.Hash()
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return hashes[idx[i]] < hashes[idx[j]] })
+
+	out := make(Vector, 0, k)
+	for _, i := range idx[:k] {
+		out = append(out, vec[i])
+	}
+	return out
+}
+
+// limitRatio returns the series of vec sampled by the hash of their labels.
+// A positive ratio r keeps the series whose hash falls into the lowest r of
+// the hash space, a negative one those in the highest -r, so that
+// limit_ratio(r, v) and limit_ratio(-(1-r), v) are complementary.
+func (ev *evaluator) limitRatio(r float64, vec Vector, enh *EvalNodeHelper) Vector {
+	switch {
+	case math.IsNaN(r):
+		ev.errorf("ratio value is NaN")
+	case r > 1:
+		r = 1
+	case r < -1:
+		r = -1
+	}
+	for _, s := range vec {
+		ratio := float64(s.Metric.Hash()) / float64(math.MaxUint64)
+		if (r >= 0 && ratio < r) || (r < 0 && ratio >= 1+r) {
+			enh.out = append(enh.out, s)
+		}
+	}
+	return enh.out
+}
+
 // btos returns 1 if b is true, 0 otherwise.
 func btos(b bool) float64 {
 	if b {
@@ -1765,7 +2567,7 @@ func btos(b bool) float64 {
 // result of the op operation.
 func shouldDropMetricName(op ItemType) bool {
 	switch op {
-	case itemADD, itemSUB, itemDIV, itemMUL, itemMOD:
+	case itemADD, itemSUB, itemDIV, itemMUL, itemMOD, itemATAN2:
 		return true
 	default:
 		return false
@@ -1774,12 +2576,17 @@ func shouldDropMetricName(op ItemType) bool {
 
 const (
 	DefaultLookbackDelta = 5 * time.Minute
+	DefaultSubqueryStep  = time.Minute
 )
 
 // LookbackDelta determines the time since the last sample after which a time
 // series is considered stale.
 var LookbackDelta = DefaultLookbackDelta
 
+// SubqueryStep is the step of subqueries without one in instant queries.
+// Range queries use their own interval.
+var SubqueryStep = DefaultSubqueryStep
+
 // documentedType returns the internal type to the equivalent
 // user facing terminology as defined in the documentation.
 func documentedType(t ValueType) string {
@@ -0,0 +1,637 @@
+package promql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/pkg/scheduler"
+	"github.com/lwangrabbit/promql-sdk/prompb"
+	"github.com/lwangrabbit/promql-sdk/storage"
+	"github.com/lwangrabbit/promql-sdk/util/stats"
+)
+
+func TestCancelQueryByID(t *testing.T) {
+	ng := NewEngine(EngineOpts{
+		MaxConcurrent: 1,
+		MaxSamples:    10,
+		Timeout:       time.Minute,
+	})
+
+	started := make(chan struct{})
+	q := ng.newTestQuery(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return contextDone(ctx, "test statement execution")
+	})
+	res := make(chan *Result)
+	go func() {
+		res <- q.Exec(context.Background())
+	}()
+	<-started
+
+	running := ng.RunningQueries()
+	if len(running) != 1 || running[0].ID != q.ID() {
+		t.Fatalf("unexpected running queries %v", running)
+	}
+	if !ng.CancelQuery(q.ID()) {
+		t.Fatal("expected the query to be canceled")
+	}
+	if r := <-res; r.Err != ErrQueryCanceled("test statement execution") {
+		t.Fatalf("expected cancellation, got %v", r.Err)
+	}
+	if len(ng.RunningQueries()) != 0 || ng.CancelQuery(q.ID()) {
+		t.Fatal("expected no running queries")
+	}
+}
+
+func TestCancelCoalescedQueryByID(t *testing.T) {
+	ng := NewEngine(EngineOpts{
+		MaxConcurrent:   2,
+		MaxSamples:      10,
+		Timeout:         time.Minute,
+		CoalesceQueries: true,
+	})
+	queryable := &blockingQueryable{started: make(chan struct{}), release: make(chan struct{})}
+
+	var (
+		qs  []Query
+		res = make(chan *Result)
+	)
+	for i := 0; i < 2; i++ {
+		q, err := ng.NewInstantQuery(queryable, "up", time.Unix(0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer q.Close()
+		qs = append(qs, q)
+		go func() {
+			res <- q.Exec(context.Background())
+		}()
+	}
+	<-queryable.started
+	for len(ng.RunningQueries()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	running := ng.RunningQueries()
+	if len(running) != 2 || running[0].ID+running[1].ID != qs[0].ID()+qs[1].ID() {
+		t.Fatalf("unexpected running queries %v", running)
+	}
+
+	// Cancelling one caller leaves the shared evaluation to the other one.
+	if !ng.CancelQuery(qs[0].ID()) {
+		t.Fatal("expected the query to be canceled")
+	}
+	if r := <-res; r.Err != ErrQueryCanceled(env) {
+		t.Fatalf("expected cancellation, got %v", r.Err)
+	}
+	close(queryable.release)
+	if r := <-res; r.Err != nil {
+		t.Fatalf("unexpected error %v", r.Err)
+	}
+	if len(ng.RunningQueries()) != 0 {
+		t.Fatal("expected no running queries")
+	}
+}
+
+// blockingQueryable blocks all queriers until it is released.
+type blockingQueryable struct {
+	once             sync.Once
+	started, release chan struct{}
+}
+
+func (q *blockingQueryable) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+	q.once.Do(func() { close(q.started) })
+	select {
+	case <-q.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return staticQuerier{res: &prompb.QueryResult{}}, nil
+}
+
+func TestFlightKeyPriority(t *testing.T) {
+	ng := NewEngine(EngineOpts{MaxConcurrent: 1, MaxSamples: 10, Timeout: time.Minute})
+	q, err := ng.NewInstantQuery(storage.NewHead(time.Hour, 0), "up", time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	low, _ := q.(*query).flightKey(scheduler.WithPriority(context.Background(), scheduler.PriorityLow))
+	high, _ := q.(*query).flightKey(scheduler.WithPriority(context.Background(), scheduler.PriorityHigh))
+	if low == high {
+		t.Fatalf("expected queries of different priorities to have different keys, got %s", low)
+	}
+}
+
+func TestDetailedStats(t *testing.T) {
+	h := storage.NewHead(time.Hour, 10)
+	app, err := h.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ts := int64(0); ts <= 120000; ts += 15000 {
+		app.Add(labels.FromStrings(labels.MetricName, "up", "job", "a"), ts, 1)
+		app.Add(labels.FromStrings(labels.MetricName, "up", "job", "b"), ts, 1)
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := NewEngine(EngineOpts{
+		MaxConcurrent: 1,
+		MaxSamples:    100,
+		Timeout:       time.Minute,
+	})
+	q, err := ng.NewRangeQuery(h, "up", time.Unix(60, 0), time.Unix(120, 0), 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if res := q.Exec(stats.WithDetailed(context.Background())); res.Err != nil {
+		t.Fatal(res.Err)
+	}
+
+	s := q.SampleStats()
+	if s.TotalSamples != 6 || s.PeakSamples != 6 {
+		t.Fatalf("expected 6 total and peak samples, got %d and %d", s.TotalSamples, s.PeakSamples)
+	}
+	if s.SeriesPerSelector["up"] != 2 {
+		t.Fatalf("expected 2 series for the selector, got %v", s.SeriesPerSelector)
+	}
+	expected := []stats.StepSamples{{T: 60000, V: 2}, {T: 90000, V: 2}, {T: 120000, V: 2}}
+	if !reflect.DeepEqual(s.SamplesPerStep, expected) {
+		t.Fatalf("expected %v samples per step, got %v", expected, s.SamplesPerStep)
+	}
+}
+
+// newTestEngine returns an engine for the tests with the options of opts,
+// running one query at a time of at most 10000 samples unless set otherwise.
+func newTestEngine(opts EngineOpts) *Engine {
+	opts.MaxConcurrent = 1
+	opts.Timeout = time.Minute
+	if opts.MaxSamples == 0 {
+		opts.MaxSamples = 10000
+	}
+	return NewEngine(opts)
+}
+
+// newTestHead returns a head holding the samples added by add.
+func newTestHead(t *testing.T, add func(app storage.Appender)) *storage.Head {
+	h := storage.NewHead(time.Hour, 10)
+	app, err := h.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	add(app)
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// instantQuery evaluates query at ts and fails the test on any error. The
+// query is closed when the test ends.
+func instantQuery(t *testing.T, ng *Engine, q storage.Queryable, query string, ts time.Time) *Result {
+	qry, err := ng.NewInstantQuery(q, query, ts)
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+	t.Cleanup(qry.Close)
+	res := qry.Exec(context.Background())
+	if res.Err != nil {
+		t.Fatalf("%s: %s", query, res.Err)
+	}
+	return res
+}
+
+// rangeQuery evaluates query from start to end and fails the test on any
+// error. The query is closed when the test ends.
+func rangeQuery(t *testing.T, ng *Engine, q storage.Queryable, query string, start, end time.Time, step time.Duration) Matrix {
+	qry, err := ng.NewRangeQuery(q, query, start, end, step)
+	if err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+	t.Cleanup(qry.Close)
+	res := qry.Exec(context.Background())
+	if res.Err != nil {
+		t.Fatalf("%s: %s", query, res.Err)
+	}
+	return res.Value.(Matrix)
+}
+
+// instantCase is a query returning a single sample of the expected value.
+type instantCase struct {
+	query    string
+	expected float64
+}
+
+// runInstantCases evaluates the queries of cases at ts and checks their
+// results.
+func runInstantCases(t *testing.T, ng *Engine, q storage.Queryable, ts time.Time, cases []instantCase) {
+	for _, c := range cases {
+		v := instantQuery(t, ng, q, c.query, ts).Value.(Vector)
+		if len(v) != 1 || v[0].V != c.expected {
+			t.Fatalf("%s: expected %v, got %v", c.query, c.expected, v)
+		}
+	}
+}
+
+// newCounterTest returns a head holding the counter c, increasing by 1/s for
+// 10m and then by 2/s for 10m, and an engine to query it.
+func newCounterTest(t *testing.T) (*storage.Head, *Engine) {
+	h := newTestHead(t, func(app storage.Appender) {
+		for ts := int64(0); ts <= 1200000; ts += 15000 {
+			v := float64(ts) / 1000
+			if ts > 600000 {
+				v = 600 + 2*float64(ts-600000)/1000
+			}
+			app.Add(labels.FromStrings(labels.MetricName, "c"), ts, v)
+		}
+	})
+	return h, newTestEngine(EngineOpts{})
+}
+
+func TestSubquery(t *testing.T) {
+	h, ng := newCounterTest(t)
+	runInstantCases(t, ng, h, time.Unix(1200, 0), []instantCase{
+		{`max_over_time(rate(c[1m])[20m:1m])`, 2},
+		{`min_over_time(rate(c[1m])[5m:])`, 2},
+		{`min_over_time(rate(c[1m])[5m:] offset 10m)`, 1},
+		{`count_over_time((c > 0)[10m:2m])`, 6},
+	})
+}
+
+func TestAtModifier(t *testing.T) {
+	h, ng := newCounterTest(t)
+	for _, c := range []struct {
+		query    string
+		expected float64
+	}{
+		{`c @ 300`, 300},
+		{`rate(c[1m] @ 300)`, 1},
+		{`rate(c[1m] @ end())`, 2},
+		{`rate(c[1m] @ 300) + rate(c[1m])`, 3},
+		{`max_over_time(rate(c[1m])[5m:1m] @ 600)`, 1},
+	} {
+		m := rangeQuery(t, ng, h, c.query, time.Unix(900, 0), time.Unix(1200, 0), time.Minute)
+		if len(m) != 1 || len(m[0].Points) != 6 {
+			t.Fatalf("%s: expected 6 points of one series, got %v", c.query, m)
+		}
+		for _, p := range m[0].Points {
+			if p.V != c.expected {
+				t.Fatalf("%s: expected %v, got %v", c.query, c.expected, m)
+			}
+		}
+	}
+}
+
+func TestNegativeOffset(t *testing.T) {
+	h, ng := newCounterTest(t)
+	runInstantCases(t, ng, h, time.Unix(300, 0), []instantCase{
+		{`c offset -5m`, 600},
+		{`rate(c[1m] offset -10m)`, 2},
+		{`sum(rate(c[1m])) offset -10m`, 2},
+		{`max_over_time(rate(c[1m])[5m:] offset -10m)`, 2},
+	})
+}
+
+func TestLookahead(t *testing.T) {
+	for _, c := range []struct {
+		query     string
+		lookahead int64
+	}{
+		{`c`, 0},
+		{`c offset 5m`, 0},
+		{`c offset -5m`, 300000},
+		{`rate(c[1m] offset -10m)`, 600000},
+		{`c offset -1m + sum(c) offset -5m`, 300000},
+		{`max_over_time(rate(c[1m] offset -2m)[5m:] offset -10m)`, 720000},
+		{`c @ 100 offset -5m`, 0},
+		{`max_over_time(c[5m:] @ 100 offset -10m)`, 0},
+	} {
+		expr, err := ParseExpr(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Lookahead(expr); got != c.lookahead {
+			t.Fatalf("%s: expected lookahead %d, got %d", c.query, c.lookahead, got)
+		}
+	}
+}
+
+func TestOverTimeFunctions(t *testing.T) {
+	h := newTestHead(t, func(app storage.Appender) {
+		for i, v := range []float64{3, 1, 4, 1, 5, 9} {
+			app.Add(labels.FromStrings(labels.MetricName, "g"), int64(i)*60000, v)
+		}
+	})
+	ng := newTestEngine(EngineOpts{})
+	runInstantCases(t, ng, h, time.Unix(300, 0), []instantCase{
+		{`last_over_time(g[5m])`, 9},
+		{`first_over_time(g[5m])`, 3},
+		{`present_over_time(g[5m])`, 1},
+		{`mad_over_time(g[5m])`, 2},
+		{`ts_of_max_over_time(g[5m])`, 300},
+		{`ts_of_min_over_time(g[5m])`, 180},
+	})
+
+	for _, c := range []struct {
+		query    string
+		expected Vector
+	}{
+		{`absent_over_time(g[5m])`, Vector{}},
+		{`absent_over_time(g[5m:1m])`, Vector{}},
+		{`absent_over_time(h{job="x"}[5m])`, Vector{{Metric: labels.FromStrings("job", "x"), Point: Point{T: 300000, V: 1}}}},
+		{`absent_over_time(h{job="x",instance=~".+"}[5m])`, Vector{{Metric: labels.FromStrings("job", "x"), Point: Point{T: 300000, V: 1}}}},
+		{`absent_over_time(rate(h{job="x"}[1m])[5m:1m])`, Vector{{Metric: labels.Labels{}, Point: Point{T: 300000, V: 1}}}},
+	} {
+		if v := instantQuery(t, ng, h, c.query, time.Unix(300, 0)).Value.(Vector); !reflect.DeepEqual(v, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", c.query, c.expected, v)
+		}
+	}
+
+	// g is absent from the window from 420s on.
+	m := rangeQuery(t, ng, h, `absent_over_time(g[1m])`, time.Unix(300, 0), time.Unix(600, 0), time.Minute)
+	if len(m) != 1 || len(m[0].Points) != 4 || m[0].Points[0].T != 420000 {
+		t.Fatalf("unexpected result %v", m)
+	}
+}
+
+func TestMathFunctions(t *testing.T) {
+	ng := newTestEngine(EngineOpts{})
+	h := storage.NewHead(time.Hour, 10)
+	for _, c := range []struct {
+		query    string
+		expected Vector
+	}{
+		{`sgn(vector(-2))`, Vector{{Point: Point{V: -1}}}},
+		{`clamp(vector(5), 0, 3)`, Vector{{Point: Point{V: 3}}}},
+		{`clamp(vector(5), 3, 0)`, Vector{}},
+		{`deg(vector(pi()))`, Vector{{Point: Point{V: 180}}}},
+		{`cosh(vector(0)) + sin(vector(0))`, Vector{{Point: Point{V: 1}}}},
+		{`vector(1) atan2 vector(0) - rad(vector(90))`, Vector{{Point: Point{V: 0}}}},
+	} {
+		v := instantQuery(t, ng, h, c.query, time.Unix(300, 0)).Value.(Vector)
+		if len(v) != len(c.expected) || len(v) > 0 && v[0].V != c.expected[0].V {
+			t.Fatalf("%s: expected %v, got %v", c.query, c.expected, v)
+		}
+	}
+}
+
+func TestGroupAndLimit(t *testing.T) {
+	h := newTestHead(t, func(app storage.Appender) {
+		for i := 0; i < 10; i++ {
+			l := labels.FromStrings(labels.MetricName, "x", "i", strconv.Itoa(i), "a", strconv.Itoa(i%2))
+			for ts := int64(0); ts <= 600000; ts += 15000 {
+				app.Add(l, ts, float64(ts+int64(i)))
+			}
+		}
+	})
+	// Native histogram series are grouped and selected like float series.
+	hist := &prompb.QueryResult{}
+	for i := 0; i < 10; i++ {
+		ts := &prompb.TimeSeries{
+			Labels: []*prompb.Label{
+				{Name: labels.MetricName, Value: "h"},
+				{Name: "a", Value: strconv.Itoa(i % 2)},
+				{Name: "i", Value: strconv.Itoa(i)},
+			},
+		}
+		for ms := int64(0); ms <= 600000; ms += 15000 {
+			ts.Histograms = append(ts.Histograms, prompb.Histogram{
+				Count:     &prompb.Histogram_CountInt{CountInt: uint64(i)},
+				ZeroCount: &prompb.Histogram_ZeroCountInt{ZeroCountInt: uint64(i)},
+				Timestamp: ms,
+			})
+		}
+		hist.Timeseries = append(hist.Timeseries, ts)
+	}
+	queryable := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return staticQuerier{res: hist}, nil
+	})
+
+	ng := newTestEngine(EngineOpts{})
+	for _, c := range []struct {
+		queryable  storage.Queryable
+		query      string
+		series     int
+		histograms bool
+	}{
+		{h, `group by (a) (x)`, 2, false},
+		{h, `limitk(3, x)`, 3, false},
+		{h, `limitk by (a) (2, x)`, 4, false},
+		{h, `limit_ratio(0.5, x) or limit_ratio(-0.5, x)`, 10, false},
+		{h, `limit_ratio(0.5, x) and limit_ratio(-0.5, x)`, 0, false},
+		{queryable, `group by (a) (h)`, 2, false},
+		{queryable, `limitk(3, h)`, 3, true},
+		{queryable, `limitk by (a) (2, h)`, 4, true},
+		{queryable, `limit_ratio(0.5, h) or limit_ratio(-0.5, h)`, 10, true},
+	} {
+		// The same series are selected at all steps.
+		m := rangeQuery(t, ng, c.queryable, c.query, time.Unix(300, 0), time.Unix(600, 0), time.Minute)
+		if len(m) != c.series {
+			t.Fatalf("%s: expected %d series, got %v", c.query, c.series, m)
+		}
+		for _, s := range m {
+			if len(s.Points) != 6 {
+				t.Fatalf("%s: expected 6 points, got %v", c.query, m)
+			}
+			if p := s.Points[0]; (p.H != nil) != c.histograms {
+				t.Fatalf("%s: expected histograms %v, got %v", c.query, c.histograms, m)
+			}
+		}
+	}
+}
+
+func TestLabelFunctions(t *testing.T) {
+	h := newTestHead(t, func(app storage.Appender) {
+		for _, node := range []string{"node10", "node2", "node1"} {
+			app.Add(labels.FromStrings(labels.MetricName, "up", "instance", node, "job", "Api"), 0, 1)
+		}
+	})
+	ng := newTestEngine(EngineOpts{})
+	for _, c := range []struct {
+		query    string
+		expected []string
+	}{
+		{`sort_by_label(up, "instance")`, []string{
+			`{__name__="up", instance="node1", job="Api"}`,
+			`{__name__="up", instance="node2", job="Api"}`,
+			`{__name__="up", instance="node10", job="Api"}`,
+		}},
+		{`sort_by_label_desc(label_keep(up, "instance"), "instance")`, []string{
+			`{instance="node10"}`,
+			`{instance="node2"}`,
+			`{instance="node1"}`,
+		}},
+		{`sort_by_label(label_set(label_del(up, "job"), "env", "prod", "__name__", ""), "instance")`, []string{
+			`{env="prod", instance="node1"}`,
+			`{env="prod", instance="node2"}`,
+			`{env="prod", instance="node10"}`,
+		}},
+		{`sort_by_label(label_lowercase(label_move(up{instance="node1"}, "job", "service"), "service"), "instance")`, []string{
+			`{__name__="up", instance="node1", service="api"}`,
+		}},
+		{`label_uppercase(label_copy(up{instance="node1"}, "instance", "host"), "job")`, []string{
+			`{__name__="up", host="node1", instance="node1", job="API"}`,
+		}},
+		{`label_copy(up{instance="node1"}, "host", "job")`, []string{
+			`{__name__="up", instance="node1", job="Api"}`,
+		}},
+		{`label_move(up{instance="node1"}, "host", "instance", "job", "service")`, []string{
+			`{__name__="up", instance="node1", service="Api"}`,
+		}},
+	} {
+		v := instantQuery(t, ng, h, c.query, time.Unix(60, 0)).Value.(Vector)
+		got := make([]string, 0, len(v))
+		for _, s := range v {
+			got = append(got, s.Metric.String())
+		}
+		if !reflect.DeepEqual(got, c.expected) {
+			t.Fatalf("%s: expected %v, got %v", c.query, c.expected, got)
+		}
+	}
+}
+
+func TestNativeHistograms(t *testing.T) {
+	// The buckets (1,2] and (2,4] grow by 1 and 2 per minute.
+	ts := &prompb.TimeSeries{
+		Labels: []*prompb.Label{{Name: labels.MetricName, Value: "h"}},
+	}
+	for i := int64(0); i <= 5; i++ {
+		ts.Histograms = append(ts.Histograms, prompb.Histogram{
+			Count:          &prompb.Histogram_CountInt{CountInt: uint64(3 * i)},
+			Sum:            float64(7 * i),
+			ZeroCount:      &prompb.Histogram_ZeroCountInt{},
+			PositiveSpans:  []prompb.BucketSpan{{Offset: 1, Length: 2}},
+			PositiveDeltas: []int64{i, i},
+			Timestamp:      i * 60000,
+		})
+	}
+	queryable := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return staticQuerier{res: &prompb.QueryResult{Timeseries: []*prompb.TimeSeries{ts}}}, nil
+	})
+
+	ng := newTestEngine(EngineOpts{})
+	mean := 35.0 / 15
+	d1, d2 := math.Sqrt(2)-mean, math.Sqrt(8)-mean
+	runInstantCases(t, ng, queryable, time.Unix(300, 0), []instantCase{
+		{`histogram_count(h)`, 15},
+		{`histogram_sum(h)`, 35},
+		{`histogram_count(increase(h[5m]))`, 15},
+		{`histogram_quantile(0.5, h)`, 2.5},
+		{`histogram_fraction(0, 2, h)`, 1.0 / 3},
+		{`histogram_stddev(h)`, math.Sqrt((5*d1*d1 + 10*d2*d2) / 15)},
+		{`histogram_count(sum(h) * 2)`, 30},
+	})
+
+	b, err := json.Marshal(instantQuery(t, ng, queryable, `h`, time.Unix(300, 0)).Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"metric":{"__name__":"h"},"histogram":[300,{"count":"15","sum":"35","buckets":[[0,"1","2","5"],[0,"2","4","10"]]}]}]`
+	if string(b) != expected {
+		t.Fatalf("expected %s, got %s", expected, b)
+	}
+}
+
+func TestClassicHistogramFraction(t *testing.T) {
+	h := newTestHead(t, func(app storage.Appender) {
+		for _, b := range []struct {
+			job, le string
+			v       float64
+		}{
+			{"a", "1", 2}, {"a", "2", 6}, {"a", "4", 8}, {"a", "+Inf", 10},
+			// Not monotonic.
+			{"b", "1", 5}, {"b", "2", 3}, {"b", "+Inf", 6},
+			// No +Inf bucket.
+			{"c", "1", 1},
+		} {
+			app.Add(labels.FromStrings(labels.MetricName, "h_bucket", "job", b.job, "le", b.le), 0, b.v)
+		}
+	})
+
+	for _, c := range []struct {
+		interpolation BucketInterpolation
+		query         string
+		expected      map[string]float64
+		warnings      int
+	}{
+		{
+			query:    `histogram_fraction(0, 1, h_bucket)`,
+			expected: map[string]float64{"a": 0.2, "b": 5.0 / 6, "c": math.NaN()},
+			warnings: 2,
+		},
+		{
+			query:    `histogram_fraction(1, 3, h_bucket{job="a"})`,
+			expected: map[string]float64{"a": 0.5},
+		},
+		{
+			interpolation: ExponentialInterpolation,
+			query:         `histogram_fraction(1, 3, h_bucket{job="a"})`,
+			expected:      map[string]float64{"a": (4 + 2*math.Log2(1.5)) / 10},
+		},
+	} {
+		ng := newTestEngine(EngineOpts{MaxSamples: 100, BucketInterpolation: c.interpolation})
+		res := instantQuery(t, ng, h, c.query, time.Unix(0, 0))
+		v := res.Value.(Vector)
+		if len(v) != len(c.expected) {
+			t.Fatalf("%s: expected %d samples, got %v", c.query, len(c.expected), v)
+		}
+		for _, s := range v {
+			exp := c.expected[s.Metric.Get("job")]
+			if !(math.IsNaN(exp) && math.IsNaN(s.V) || math.Abs(s.V-exp) < 1e-12) {
+				t.Fatalf("%s: expected %v for %s, got %v", c.query, exp, s.Metric, s.V)
+			}
+		}
+		if len(res.Warnings) != c.warnings {
+			t.Fatalf("%s: expected %d warnings, got %q", c.query, c.warnings, res.Warnings)
+		}
+	}
+}
+
+func TestDateFunctionsTimeZone(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	ng := newTestEngine(EngineOpts{MaxSamples: 100, Location: shanghai})
+	h := storage.NewHead(time.Hour, 10)
+	// Europe/Berlin switches to summer time at 2021-03-28 01:00 UTC.
+	beforeDST := time.Date(2021, 3, 27, 1, 30, 0, 0, time.UTC).Unix()
+	afterDST := time.Date(2021, 3, 28, 1, 30, 0, 0, time.UTC).Unix()
+	runInstantCases(t, ng, h, time.Unix(0, 0), []instantCase{
+		{fmt.Sprintf(`hour(vector(%d), "Europe/Berlin")`, beforeDST), 2},
+		{fmt.Sprintf(`hour(vector(%d), "Europe/Berlin")`, afterDST), 3},
+		{fmt.Sprintf(`hour(vector(%d), "UTC")`, afterDST), 1},
+		{fmt.Sprintf(`hour(vector(%d))`, afterDST), 9},
+		{fmt.Sprintf(`day_of_year(vector(%d))`, afterDST), 87},
+		{fmt.Sprintf(`is_weekend(vector(%d), "Europe/Berlin")`, afterDST), 1},
+		{`is_weekend(vector(1616979600), "America/Los_Angeles")`, 1},
+		{`is_weekend(vector(1616979600), "Asia/Shanghai")`, 0},
+	})
+
+	if _, err := ng.NewInstantQuery(h, `hour(vector(0), "Mars/Olympus_Mons")`, time.Unix(0, 0)); err == nil {
+		t.Fatal("expected an error for an unknown time zone")
+	}
+}
+
+// staticQuerier returns the same query result for every select.
+type staticQuerier struct {
+	res *prompb.QueryResult
+}
+
+func (q staticQuerier) Select(*storage.SelectParams, ...*labels.Matcher) (storage.SeriesSet, error) {
+	return storage.FromQueryResult(q.res), nil
+}
+
+func (staticQuerier) LabelValues(string) ([]string, error) { return nil, nil }
+
+func (staticQuerier) Close() error { return nil }
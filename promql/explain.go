@@ -0,0 +1,93 @@
+package promql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/pkg/timestamp"
+	"github.com/lwangrabbit/promql-sdk/storage"
+)
+
+// SelectorPlan is the fetch plan of a single selector.
+type SelectorPlan struct {
+	Selector string        `json:"selector"`
+	Range    time.Duration `json:"range,omitempty"`
+	Offset   time.Duration `json:"offset,omitempty"`
+	// Mint and Maxt are the time range of the querier in milliseconds,
+	// including the lookback of all selectors.
+	Mint int64 `json:"mint"`
+	Maxt int64 `json:"maxt"`
+	// Hints are the select hints passed to the remote read endpoints.
+	Hints *storage.SelectParams `json:"hints"`
+	// Endpoints lists the remote read endpoints and local queryables that
+	// would be contacted or skipped.
+	Endpoints []storage.SelectPlan `json:"endpoints,omitempty"`
+}
+
+// Explanation is the fetch plan of a query.
+type Explanation struct {
+	// Tree is the printed AST of the query.
+	Tree      string         `json:"tree"`
+	Selectors []SelectorPlan `json:"selectors"`
+	// Profile is the execution profile of the expression, only set by
+	// ExplainAnalyze.
+	Profile *NodeProfile `json:"profile,omitempty"`
+}
+
+// Explain returns the fetch plan of the query evaluated from start to end
+// with the given interval, without executing it. Instant queries have equal
+// start and end and a zero interval. Endpoints are only listed if the
+// queryable implements storage.Explainer.
+func Explain(q storage.Queryable, qs string, start, end time.Time, interval time.Duration) (*Explanation, error) {
+	expr, err := ParseExpr(qs)
+	if err != nil {
+		return nil, err
+	}
+	if interval != 0 && expr.Type() != ValueTypeVector && expr.Type() != ValueTypeScalar {
+		return nil, fmt.Errorf("invalid expression type %q for range query, must be Scalar or instant Vector", documentedType(expr.Type()))
+	}
+	resolveStartEnd(expr, start, end)
+	s := &EvalStmt{
+		Expr:     expr,
+		Start:    start,
+		End:      end,
+		Interval: interval,
+	}
+
+	mint, maxt := selectRange(s)
+	explainer, _ := q.(storage.Explainer)
+	e := &Explanation{Tree: Tree(expr)}
+	Inspect(expr, func(node Node, path []Node) error {
+		plan := SelectorPlan{
+			Mint: timestamp.FromTime(mint),
+			Maxt: timestamp.FromTime(maxt),
+		}
+		var matchers []*labels.Matcher
+		switch n := node.(type) {
+		case *VectorSelector:
+			plan.Offset = n.Offset
+			matchers = n.LabelMatchers
+		case *MatrixSelector:
+			plan.Range = n.Range
+			plan.Offset = n.Offset
+			matchers = n.LabelMatchers
+		default:
+			return nil
+		}
+		plan.Selector = node.String()
+		plan.Hints = selectParams(s, node, path)
+		if explainer != nil {
+			plan.Endpoints, err = explainer.Explain(plan.Mint, plan.Maxt, plan.Hints, matchers...)
+			if err != nil {
+				return err
+			}
+		}
+		e.Selectors = append(e.Selectors, plan)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
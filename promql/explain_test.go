@@ -0,0 +1,91 @@
+package promql
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/storage"
+)
+
+func TestExplain(t *testing.T) {
+	u1, _ := url.Parse("http://a.example.com/read")
+	u2, _ := url.Parse("http://b.example.com/read")
+	s, err := storage.NewStorage([]*storage.RemoteReadConfig{
+		{URL: &config_util.URL{URL: u1}},
+		{URL: &config_util.URL{URL: u2}, RequiredMatchers: model.LabelSet{"env": "prod"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Explain(s, `rate(http_requests_total[5m] offset 1m)`, time.Unix(3600, 0), time.Unix(7200, 0), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(e.Tree, "MatrixSelector") {
+		t.Fatalf("unexpected tree %s", e.Tree)
+	}
+	if len(e.Selectors) != 1 {
+		t.Fatalf("expected 1 selector, got %d", len(e.Selectors))
+	}
+	plan := e.Selectors[0]
+	if plan.Mint != 3240000 || plan.Maxt != 7200000 {
+		t.Fatalf("unexpected range %d-%d", plan.Mint, plan.Maxt)
+	}
+	if h := plan.Hints; h.Func != "rate" || h.Step != 60000 || h.Start != 3240000 || h.End != 7140000 {
+		t.Fatalf("unexpected hints %+v", h)
+	}
+	if len(plan.Endpoints) != 2 {
+		t.Fatalf("expected 2 endpoints, got %d", len(plan.Endpoints))
+	}
+	if plan.Endpoints[0].Query == nil || plan.Endpoints[0].Skipped != "" {
+		t.Fatalf("expected the first endpoint to be read, got %+v", plan.Endpoints[0])
+	}
+	if plan.Endpoints[1].Query != nil || plan.Endpoints[1].Skipped == "" {
+		t.Fatalf("expected the second endpoint to be skipped, got %+v", plan.Endpoints[1])
+	}
+}
+
+func TestExplainAnalyze(t *testing.T) {
+	h := storage.NewHead(time.Hour, 10)
+	app, err := h.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ts := int64(0); ts <= 120000; ts += 15000 {
+		app.Add(labels.FromStrings(labels.MetricName, "up", "job", "a"), ts, float64(ts))
+		app.Add(labels.FromStrings(labels.MetricName, "up", "job", "b"), ts, float64(ts))
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := NewEngine(EngineOpts{
+		MaxConcurrent: 1,
+		MaxSamples:    100,
+		Timeout:       time.Minute,
+	})
+	e, err := ng.ExplainAnalyze(context.Background(), h, "sum(rate(up[1m]))", time.Unix(60, 0), time.Unix(120, 0), 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := e.Profile
+	if p == nil || p.Type != "AggregateExpr" || p.Series != 1 || p.Points != 3 {
+		t.Fatalf("unexpected profile %v", p)
+	}
+	if len(p.Children) != 1 || p.Children[0].Type != "Call" || p.Children[0].Series != 2 {
+		t.Fatalf("unexpected profile %v", p)
+	}
+	sel := p.Children[0].Children
+	if len(sel) != 1 || sel[0].Type != "MatrixSelector" || sel[0].Samples == 0 || sel[0].Samples != p.Samples {
+		t.Fatalf("unexpected profile %v", p)
+	}
+}
@@ -24,14 +24,19 @@ import (
 
 	"github.com/prometheus/common/model"
 
+	"github.com/lwangrabbit/promql-sdk/pkg/histogram"
 	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/util/strutil"
 )
 
 // Function represents a function of the expression language and is
 // used by function nodes.
 type Function struct {
-	Name       string
-	ArgTypes   []ValueType
+	Name     string
+	ArgTypes []ValueType
+	// Variadic is the number of trailing arguments that are optional. If
+	// it is negative, the last argument may be repeated any number of
+	// times, including none.
 	Variadic   int
 	ReturnType ValueType
 
@@ -65,10 +70,14 @@ func funcTime(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
 func extrapolatedRate(vals []Value, args Expressions, enh *EvalNodeHelper, isCounter bool, isRate bool) Vector {
 	ms := args[0].(*MatrixSelector)
 
+	ts := enh.ts
+	if ms.Timestamp != nil {
+		ts = *ms.Timestamp
+	}
 	var (
 		matrix     = vals[0].(Matrix)
-		rangeStart = enh.ts - durationMilliseconds(ms.Range+ms.Offset)
-		rangeEnd   = enh.ts - durationMilliseconds(ms.Offset)
+		rangeStart = ts - durationMilliseconds(ms.Range+ms.Offset)
+		rangeEnd   = ts - durationMilliseconds(ms.Offset)
 	)
 
 	for _, samples := range matrix {
@@ -80,14 +89,30 @@ func extrapolatedRate(vals []Value, args Expressions, enh *EvalNodeHelper, isCou
 		var (
 			counterCorrection float64
 			lastValue         float64
+			resultValue       float64
+			resultHistogram   *histogram.FloatHistogram
+			histograms        int
 		)
 		for _, sample := range samples.Points {
-			if isCounter && sample.V < lastValue {
-				counterCorrection += lastValue
+			if sample.H != nil {
+				histograms++
+			}
+		}
+		switch histograms {
+		case len(samples.Points):
+			resultHistogram = histogramIncrease(samples.Points, isCounter)
+		case 0:
+			for _, sample := range samples.Points {
+				if isCounter && sample.V < lastValue {
+					counterCorrection += lastValue
+				}
+				lastValue = sample.V
 			}
-			lastValue = sample.V
+			resultValue = lastValue - samples.Points[0].V + counterCorrection
+		default:
+			// Floats and histograms cannot be combined.
+			continue
 		}
-		resultValue := lastValue - samples.Points[0].V + counterCorrection
 
 		// Duration between first/last samples and boundary of range.
 		durationToStart := float64(samples.Points[0].T-rangeStart) / 1000
@@ -127,18 +152,35 @@ func extrapolatedRate(vals []Value, args Expressions, enh *EvalNodeHelper, isCou
 		} else {
 			extrapolateToInterval += averageDurationBetweenSamples / 2
 		}
-		resultValue = resultValue * (extrapolateToInterval / sampledInterval)
+		factor := extrapolateToInterval / sampledInterval
 		if isRate {
-			resultValue = resultValue / ms.Range.Seconds()
+			factor /= ms.Range.Seconds()
+		}
+		if resultHistogram != nil {
+			resultHistogram.Mul(factor)
 		}
 
 		enh.out = append(enh.out, Sample{
-			Point: Point{V: resultValue},
+			Point: Point{V: resultValue * factor, H: resultHistogram},
 		})
 	}
 	return enh.out
 }
 
+// histogramIncrease returns the difference between the last and the first
+// histogram of points, allowing for counter resets if isCounter is true.
+func histogramIncrease(points []Point, isCounter bool) *histogram.FloatHistogram {
+	res := points[len(points)-1].H.Copy().Sub(points[0].H)
+	if isCounter {
+		for i := 1; i < len(points); i++ {
+			if points[i].H.DetectReset(points[i-1].H) {
+				res.Add(points[i-1].H)
+			}
+		}
+	}
+	return res
+}
+
 // === delta(Matrix ValueTypeMatrix) Vector ===
 func funcDelta(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
 	return extrapolatedRate(vals, args, enh, false, false)
@@ -293,6 +335,23 @@ func funcSortDesc(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
 	return Vector(byValueSorter)
 }
 
+// === clamp(Vector ValueTypeVector, min, max Scalar) Vector ===
+func funcClamp(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	vec := vals[0].(Vector)
+	min := vals[1].(Vector)[0].Point.V
+	max := vals[2].(Vector)[0].Point.V
+	if max < min {
+		return enh.out
+	}
+	for _, el := range vec {
+		enh.out = append(enh.out, Sample{
+			Metric: enh.dropMetricName(el.Metric),
+			Point:  Point{V: math.Max(min, math.Min(max, el.V))},
+		})
+	}
+	return enh.out
+}
+
 // === clamp_max(Vector ValueTypeVector, max Scalar) Vector ===
 func funcClampMax(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
 	vec := vals[0].(Vector)
@@ -475,27 +534,113 @@ func funcStdvarOverTime(vals []Value, args Expressions, enh *EvalNodeHelper) Vec
 	})
 }
 
+// === last_over_time(Matrix ValueTypeMatrix) Vector ===
+func funcLastOverTime(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return aggrOverTime(vals, enh, func(values []Point) float64 {
+		return values[len(values)-1].V
+	})
+}
+
+// === first_over_time(Matrix ValueTypeMatrix) Vector ===
+func funcFirstOverTime(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return aggrOverTime(vals, enh, func(values []Point) float64 {
+		return values[0].V
+	})
+}
+
+// === present_over_time(Matrix ValueTypeMatrix) Vector ===
+func funcPresentOverTime(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return aggrOverTime(vals, enh, func(values []Point) float64 {
+		return 1
+	})
+}
+
+// === absent_over_time(Matrix ValueTypeMatrix) Vector ===
+//
+// The series present are turned into the steps at which all of them are
+// absent by the engine, see (*evaluator).absentOverTime.
+func funcAbsentOverTime(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return funcPresentOverTime(vals, args, enh)
+}
+
+// === mad_over_time(Matrix ValueTypeMatrix) Vector ===
+func funcMadOverTime(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return aggrOverTime(vals, enh, func(values []Point) float64 {
+		heap := make(vectorByValueHeap, 0, len(values))
+		for _, v := range values {
+			heap = append(heap, Sample{Point: Point{V: v.V}})
+		}
+		median := quantile(0.5, heap)
+		for i, v := range values {
+			heap[i].V = math.Abs(v.V - median)
+		}
+		return quantile(0.5, heap)
+	})
+}
+
+// === ts_of_max_over_time(Matrix ValueTypeMatrix) Vector ===
+func funcTsOfMaxOverTime(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return aggrOverTime(vals, enh, func(values []Point) float64 {
+		return tsOfOverTime(values, func(cur, max float64) bool {
+			return cur >= max || math.IsNaN(max)
+		})
+	})
+}
+
+// === ts_of_min_over_time(Matrix ValueTypeMatrix) Vector ===
+func funcTsOfMinOverTime(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return aggrOverTime(vals, enh, func(values []Point) float64 {
+		return tsOfOverTime(values, func(cur, min float64) bool {
+			return cur <= min || math.IsNaN(min)
+		})
+	})
+}
+
+// tsOfOverTime returns the timestamp in seconds of the last point whose value
+// replaces the one selected so far according to better.
+func tsOfOverTime(values []Point, better func(cur, sel float64) bool) float64 {
+	sel := values[0]
+	for _, v := range values[1:] {
+		if better(v.V, sel.V) {
+			sel = v
+		}
+	}
+	return float64(sel.T) / 1000
+}
+
 // === absent(Vector ValueTypeVector) Vector ===
 func funcAbsent(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
 	if len(vals[0].(Vector)) > 0 {
 		return enh.out
 	}
-	m := []labels.Label{}
-
-	if vs, ok := args[0].(*VectorSelector); ok {
-		for _, ma := range vs.LabelMatchers {
-			if ma.Type == labels.MatchEqual && ma.Name != labels.MetricName {
-				m = append(m, labels.Label{Name: ma.Name, Value: ma.Value})
-			}
-		}
-	}
 	return append(enh.out,
 		Sample{
-			Metric: labels.New(m...),
+			Metric: absentLabels(args[0]),
 			Point:  Point{V: 1},
 		})
 }
 
+// absentLabels returns the labels of the result of absent and
+// absent_over_time, which are the labels the selector of the argument
+// matches for equality, if it is a selector.
+func absentLabels(expr Expr) labels.Labels {
+	var matchers []*labels.Matcher
+	switch n := expr.(type) {
+	case *VectorSelector:
+		matchers = n.LabelMatchers
+	case *MatrixSelector:
+		matchers = n.LabelMatchers
+	}
+
+	m := []labels.Label{}
+	for _, ma := range matchers {
+		if ma.Type == labels.MatchEqual && ma.Name != labels.MetricName {
+			m = append(m, labels.Label{Name: ma.Name, Value: ma.Value})
+		}
+	}
+	return labels.New(m...)
+}
+
 func simpleFunc(vals []Value, enh *EvalNodeHelper, f func(float64) float64) Vector {
 	for _, el := range vals[0].(Vector) {
 		enh.out = append(enh.out, Sample{
@@ -531,6 +676,99 @@ func funcSqrt(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
 	return simpleFunc(vals, enh, math.Sqrt)
 }
 
+// === sgn(Vector ValueTypeVector) Vector ===
+func funcSgn(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, func(v float64) float64 {
+		switch {
+		case v < 0:
+			return -1
+		case v > 0:
+			return 1
+		}
+		// Zero and NaN are returned as they are.
+		return v
+	})
+}
+
+// === sin(Vector ValueTypeVector) Vector ===
+func funcSin(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Sin)
+}
+
+// === cos(Vector ValueTypeVector) Vector ===
+func funcCos(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Cos)
+}
+
+// === tan(Vector ValueTypeVector) Vector ===
+func funcTan(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Tan)
+}
+
+// === asin(Vector ValueTypeVector) Vector ===
+func funcAsin(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Asin)
+}
+
+// === acos(Vector ValueTypeVector) Vector ===
+func funcAcos(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Acos)
+}
+
+// === atan(Vector ValueTypeVector) Vector ===
+func funcAtan(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Atan)
+}
+
+// === sinh(Vector ValueTypeVector) Vector ===
+func funcSinh(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Sinh)
+}
+
+// === cosh(Vector ValueTypeVector) Vector ===
+func funcCosh(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Cosh)
+}
+
+// === tanh(Vector ValueTypeVector) Vector ===
+func funcTanh(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Tanh)
+}
+
+// === asinh(Vector ValueTypeVector) Vector ===
+func funcAsinh(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Asinh)
+}
+
+// === acosh(Vector ValueTypeVector) Vector ===
+func funcAcosh(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Acosh)
+}
+
+// === atanh(Vector ValueTypeVector) Vector ===
+func funcAtanh(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, math.Atanh)
+}
+
+// === deg(Vector ValueTypeVector) Vector ===
+func funcDeg(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, func(v float64) float64 {
+		return v * 180 / math.Pi
+	})
+}
+
+// === rad(Vector ValueTypeVector) Vector ===
+func funcRad(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return simpleFunc(vals, enh, func(v float64) float64 {
+		return v * math.Pi / 180
+	})
+}
+
+// === pi() Scalar ===
+func funcPi(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return Vector{Sample{Point: Point{V: math.Pi}}}
+}
+
 // === ln(Vector ValueTypeVector) Vector ===
 func funcLn(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
 	return simpleFunc(vals, enh, math.Log)
@@ -629,6 +867,28 @@ func funcPredictLinear(vals []Value, args Expressions, enh *EvalNodeHelper) Vect
 func funcHistogramQuantile(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
 	q := vals[0].(Vector)[0].V
 	inVec := vals[1].(Vector)
+
+	for _, el := range inVec {
+		if el.H != nil {
+			enh.out = append(enh.out, Sample{
+				Metric: enh.dropMetricName(el.Metric),
+				Point:  Point{V: histogramQuantile(q, el.H)},
+			})
+		}
+	}
+	for _, mb := range enh.classicHistograms("histogram_quantile", inVec) {
+		enh.out = append(enh.out, Sample{
+			Metric: mb.metric,
+			Point:  Point{V: bucketQuantile(q, mb.buckets, enh.interpolation)},
+		})
+	}
+	return enh.out
+}
+
+// classicHistograms groups the bucket samples of vec by histogram and
+// validates the buckets of every histogram. Problems with the buckets are
+// reported as warnings. Native histogram samples are ignored.
+func (enh *EvalNodeHelper) classicHistograms(fname string, vec Vector) []*metricWithBuckets {
 	sigf := enh.signatureFunc(false, excludedLabels...)
 
 	if enh.signatureToMetricWithBuckets == nil {
@@ -638,13 +898,16 @@ func funcHistogramQuantile(vals []Value, args Expressions, enh *EvalNodeHelper)
 			v.buckets = v.buckets[:0]
 		}
 	}
-	for _, el := range inVec {
+	for _, el := range vec {
+		if el.H != nil {
+			continue
+		}
 		upperBound, err := strconv.ParseFloat(
 			el.Metric.Get(model.BucketLabel), 64,
 		)
 		if err != nil {
-			// Oops, no bucket label or malformed label value. Skip.
-			// TODO(beorn7): Issue a warning somehow.
+			// No bucket label or malformed label value. Skip.
+			enh.warnf("%s: ignoring series %s with missing or malformed %q label", fname, el.Metric, model.BucketLabel)
 			continue
 		}
 		hash := sigf(el.Metric)
@@ -661,15 +924,72 @@ func funcHistogramQuantile(vals []Value, args Expressions, enh *EvalNodeHelper)
 		mb.buckets = append(mb.buckets, bucket{upperBound, el.V})
 	}
 
+	var res []*metricWithBuckets
 	for _, mb := range enh.signatureToMetricWithBuckets {
-		if len(mb.buckets) > 0 {
-			enh.out = append(enh.out, Sample{
-				Metric: mb.metric,
-				Point:  Point{V: bucketQuantile(q, mb.buckets)},
-			})
+		if len(mb.buckets) == 0 {
+			continue
+		}
+		missingInf, repaired := validateBuckets(mb.buckets)
+		switch {
+		case missingInf:
+			enh.warnf("%s: histogram %s has no +Inf bucket", fname, mb.metric)
+		case repaired:
+			enh.warnf("%s: bucket counts of histogram %s are not monotonic and have been repaired", fname, mb.metric)
 		}
+		res = append(res, mb)
 	}
+	return res
+}
+
+// === histogram_count(Vector ValueTypeVector) Vector ===
+func funcHistogramCount(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return histogramFunc(vals[0].(Vector), enh, func(h *histogram.FloatHistogram) float64 {
+		return h.Count
+	})
+}
+
+// === histogram_sum(Vector ValueTypeVector) Vector ===
+func funcHistogramSum(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return histogramFunc(vals[0].(Vector), enh, func(h *histogram.FloatHistogram) float64 {
+		return h.Sum
+	})
+}
+
+// === histogram_stddev(Vector ValueTypeVector) Vector ===
+func funcHistogramStddev(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return histogramFunc(vals[0].(Vector), enh, histogramStddev)
+}
 
+// === histogram_fraction(lower, upper ValueTypeScalar, Vector ValueTypeVector) Vector ===
+func funcHistogramFraction(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	lower := vals[0].(Vector)[0].V
+	upper := vals[1].(Vector)[0].V
+	inVec := vals[2].(Vector)
+
+	histogramFunc(inVec, enh, func(h *histogram.FloatHistogram) float64 {
+		return histogramFraction(lower, upper, h)
+	})
+	for _, mb := range enh.classicHistograms("histogram_fraction", inVec) {
+		enh.out = append(enh.out, Sample{
+			Metric: mb.metric,
+			Point:  Point{V: bucketFraction(lower, upper, mb.buckets, enh.interpolation)},
+		})
+	}
+	return enh.out
+}
+
+// histogramFunc applies f to the native histograms of vec. Float samples are
+// ignored.
+func histogramFunc(vec Vector, enh *EvalNodeHelper, f func(*histogram.FloatHistogram) float64) Vector {
+	for _, el := range vec {
+		if el.H == nil {
+			continue
+		}
+		enh.out = append(enh.out, Sample{
+			Metric: enh.dropMetricName(el.Metric),
+			Point:  Point{V: f(el.H)},
+		})
+	}
 	return enh.out
 }
 
@@ -765,7 +1085,7 @@ func funcLabelReplace(vals []Value, args Expressions, enh *EvalNodeHelper) Vecto
 
 		enh.out = append(enh.out, Sample{
 			Metric: outMetric,
-			Point:  Point{V: el.Point.V},
+			Point:  Point{V: el.Point.V, H: el.Point.H},
 		})
 	}
 	return enh.out
@@ -832,24 +1152,211 @@ func funcLabelJoin(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
 
 		enh.out = append(enh.out, Sample{
 			Metric: outMetric,
-			Point:  Point{V: el.Point.V},
+			Point:  Point{V: el.Point.V, H: el.Point.H},
+		})
+	}
+	return enh.out
+}
+
+// === sort_by_label(vector model.ValVector, label model.LabelName...) Vector ===
+func funcSortByLabel(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return sortByLabel(vals, args, false)
+}
+
+// === sort_by_label_desc(vector model.ValVector, label model.LabelName...) Vector ===
+func funcSortByLabelDesc(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return sortByLabel(vals, args, true)
+}
+
+// sortByLabel sorts the vector by the natural order of the values of the
+// given labels. Samples with equal values sort by their full label sets.
+func sortByLabel(vals []Value, args Expressions, desc bool) Vector {
+	vector := vals[0].(Vector)
+	names := stringArgs(args[1:])
+	sort.SliceStable(vector, func(i, j int) bool {
+		a, b := vector[i].Metric, vector[j].Metric
+		if desc {
+			a, b = b, a
+		}
+		for _, name := range names {
+			if va, vb := a.Get(name), b.Get(name); va != vb {
+				return strutil.NaturalLess(va, vb)
+			}
+		}
+		return labels.Compare(a, b) < 0
+	})
+	return vector
+}
+
+// === label_set(vector model.ValVector, label, value, ...) Vector ===
+func funcLabelSet(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	pairs := labelPairs("label_set", args[1:])
+	return relabel(vals, enh, func(lb *labels.Builder, _ labels.Labels) {
+		for i := 0; i < len(pairs); i += 2 {
+			if pairs[i+1] == "" {
+				lb.Del(pairs[i])
+			} else {
+				lb.Set(pairs[i], pairs[i+1])
+			}
+		}
+	})
+}
+
+// === label_del(vector model.ValVector, label...) Vector ===
+func funcLabelDel(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	names := labelNames("label_del", args[1:])
+	return relabel(vals, enh, func(lb *labels.Builder, _ labels.Labels) {
+		lb.Del(names...)
+	})
+}
+
+// === label_keep(vector model.ValVector, label...) Vector ===
+func funcLabelKeep(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	names := labelNames("label_keep", args[1:])
+	return relabel(vals, enh, func(lb *labels.Builder, metric labels.Labels) {
+	Labels:
+		for _, l := range metric {
+			for _, name := range names {
+				if l.Name == name {
+					continue Labels
+				}
+			}
+			lb.Del(l.Name)
+		}
+	})
+}
+
+// === label_copy(vector model.ValVector, src_label, dst_label, ...) Vector ===
+func funcLabelCopy(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	pairs := labelPairs("label_copy", args[1:])
+	return relabel(vals, enh, func(lb *labels.Builder, metric labels.Labels) {
+		copyLabels(lb, metric, pairs, false)
+	})
+}
+
+// === label_move(vector model.ValVector, src_label, dst_label, ...) Vector ===
+func funcLabelMove(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	pairs := labelPairs("label_move", args[1:])
+	return relabel(vals, enh, func(lb *labels.Builder, metric labels.Labels) {
+		copyLabels(lb, metric, pairs, true)
+	})
+}
+
+// copyLabels sets the destination labels of the pairs to the values of their
+// source labels in metric, deleting the source labels if move is set. Pairs
+// whose source label is missing leave the destination label unchanged.
+func copyLabels(lb *labels.Builder, metric labels.Labels, pairs []string, move bool) {
+	for i := 0; i < len(pairs); i += 2 {
+		src, dst := pairs[i], pairs[i+1]
+		v := metric.Get(src)
+		if v == "" {
+			continue
+		}
+		if move {
+			lb.Del(src)
+		}
+		lb.Set(dst, v)
+	}
+}
+
+// === label_lowercase(vector model.ValVector, label...) Vector ===
+func funcLabelLowercase(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	names := labelNames("label_lowercase", args[1:])
+	return relabel(vals, enh, func(lb *labels.Builder, metric labels.Labels) {
+		mapLabels(lb, metric, names, strings.ToLower)
+	})
+}
+
+// === label_uppercase(vector model.ValVector, label...) Vector ===
+func funcLabelUppercase(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	names := labelNames("label_uppercase", args[1:])
+	return relabel(vals, enh, func(lb *labels.Builder, metric labels.Labels) {
+		mapLabels(lb, metric, names, strings.ToUpper)
+	})
+}
+
+// mapLabels sets the given labels of metric to their values mapped by f.
+func mapLabels(lb *labels.Builder, metric labels.Labels, names []string, f func(string) string) {
+	for _, name := range names {
+		if v := metric.Get(name); v != "" {
+			lb.Set(name, f(v))
+		}
+	}
+}
+
+// relabel applies f to the labels of every sample of the vector. The
+// resulting labels are cached per series across the steps of the evaluation.
+func relabel(vals []Value, enh *EvalNodeHelper, f func(lb *labels.Builder, metric labels.Labels)) Vector {
+	if enh.dmn == nil {
+		enh.dmn = make(map[uint64]labels.Labels, len(enh.out))
+	}
+
+	for _, el := range vals[0].(Vector) {
+		h := el.Metric.Hash()
+		outMetric, ok := enh.dmn[h]
+		if !ok {
+			lb := labels.NewBuilder(el.Metric)
+			f(lb, el.Metric)
+			outMetric = lb.Labels()
+			enh.dmn[h] = outMetric
+		}
+
+		enh.out = append(enh.out, Sample{
+			Metric: outMetric,
+			Point:  Point{V: el.Point.V, H: el.Point.H},
 		})
 	}
 	return enh.out
 }
 
+// stringArgs returns the values of the string literal arguments.
+func stringArgs(args Expressions) []string {
+	strs := make([]string, 0, len(args))
+	for _, a := range args {
+		strs = append(strs, a.(*StringLiteral).Val)
+	}
+	return strs
+}
+
+// labelNames returns the label names given as arguments to the function.
+func labelNames(fname string, args Expressions) []string {
+	names := stringArgs(args)
+	for _, name := range names {
+		if !model.LabelName(name).IsValid() {
+			panic(fmt.Errorf("invalid label name in %s(): %s", fname, name))
+		}
+	}
+	return names
+}
+
+// labelPairs returns the pairs of arguments given to the function, the first
+// of which has to be a label name. For copying and moving, both are.
+func labelPairs(fname string, args Expressions) []string {
+	pairs := stringArgs(args)
+	if len(pairs)%2 != 0 {
+		panic(fmt.Errorf("odd number of label arguments in %s()", fname))
+	}
+	for i, v := range pairs {
+		if (i%2 == 0 || fname != "label_set") && !model.LabelName(v).IsValid() {
+			panic(fmt.Errorf("invalid label name in %s(): %s", fname, v))
+		}
+	}
+	return pairs
+}
+
 // Common code for date related functions.
-func dateWrapper(vals []Value, enh *EvalNodeHelper, f func(time.Time) float64) Vector {
+func dateWrapper(vals []Value, args Expressions, enh *EvalNodeHelper, f func(time.Time) float64) Vector {
+	loc := enh.dateLocation(args)
 	if len(vals) == 0 {
 		return append(enh.out,
 			Sample{
 				Metric: labels.Labels{},
-				Point:  Point{V: f(time.Unix(enh.ts/1000, 0).UTC())},
+				Point:  Point{V: f(time.Unix(enh.ts/1000, 0).In(loc))},
 			})
 	}
 
 	for _, el := range vals[0].(Vector) {
-		t := time.Unix(int64(el.V), 0).UTC()
+		t := time.Unix(int64(el.V), 0).In(loc)
 		enh.out = append(enh.out, Sample{
 			Metric: enh.dropMetricName(el.Metric),
 			Point:  Point{V: f(t)},
@@ -858,51 +1365,99 @@ func dateWrapper(vals []Value, enh *EvalNodeHelper, f func(time.Time) float64) V
 	return enh.out
 }
 
-// === days_in_month(v Vector) Scalar ===
+// dateFunctions are the functions taking a time zone as optional second
+// argument. The time zone is validated when parsing the query.
+var dateFunctions = map[string]bool{
+	"days_in_month": true,
+	"day_of_month":  true,
+	"day_of_week":   true,
+	"day_of_year":   true,
+	"hour":          true,
+	"is_weekend":    true,
+	"minute":        true,
+	"month":         true,
+	"year":          true,
+}
+
+// dateLocation returns the time zone given as second argument of a date
+// function, or the default time zone of the engine if there is none.
+func (enh *EvalNodeHelper) dateLocation(args Expressions) *time.Location {
+	if len(args) < 2 {
+		return enh.location
+	}
+	if enh.tz == nil {
+		name := args[1].(*StringLiteral).Val
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			panic(fmt.Errorf("invalid time zone in date function: %s", name))
+		}
+		enh.tz = loc
+	}
+	return enh.tz
+}
+
+// === days_in_month(v Vector, tz String) Scalar ===
 func funcDaysInMonth(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
-	return dateWrapper(vals, enh, func(t time.Time) float64 {
+	return dateWrapper(vals, args, enh, func(t time.Time) float64 {
 		return float64(32 - time.Date(t.Year(), t.Month(), 32, 0, 0, 0, 0, time.UTC).Day())
 	})
 }
 
-// === day_of_month(v Vector) Scalar ===
+// === day_of_month(v Vector, tz String) Scalar ===
 func funcDayOfMonth(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
-	return dateWrapper(vals, enh, func(t time.Time) float64 {
+	return dateWrapper(vals, args, enh, func(t time.Time) float64 {
 		return float64(t.Day())
 	})
 }
 
-// === day_of_week(v Vector) Scalar ===
+// === day_of_week(v Vector, tz String) Scalar ===
 func funcDayOfWeek(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
-	return dateWrapper(vals, enh, func(t time.Time) float64 {
+	return dateWrapper(vals, args, enh, func(t time.Time) float64 {
 		return float64(t.Weekday())
 	})
 }
 
-// === hour(v Vector) Scalar ===
+// === day_of_year(v Vector, tz String) Scalar ===
+func funcDayOfYear(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return dateWrapper(vals, args, enh, func(t time.Time) float64 {
+		return float64(t.YearDay())
+	})
+}
+
+// === hour(v Vector, tz String) Scalar ===
 func funcHour(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
-	return dateWrapper(vals, enh, func(t time.Time) float64 {
+	return dateWrapper(vals, args, enh, func(t time.Time) float64 {
 		return float64(t.Hour())
 	})
 }
 
-// === minute(v Vector) Scalar ===
+// === is_weekend(v Vector, tz String) Scalar ===
+func funcIsWeekend(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
+	return dateWrapper(vals, args, enh, func(t time.Time) float64 {
+		if d := t.Weekday(); d == time.Saturday || d == time.Sunday {
+			return 1
+		}
+		return 0
+	})
+}
+
+// === minute(v Vector, tz String) Scalar ===
 func funcMinute(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
-	return dateWrapper(vals, enh, func(t time.Time) float64 {
+	return dateWrapper(vals, args, enh, func(t time.Time) float64 {
 		return float64(t.Minute())
 	})
 }
 
-// === month(v Vector) Scalar ===
+// === month(v Vector, tz String) Scalar ===
 func funcMonth(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
-	return dateWrapper(vals, enh, func(t time.Time) float64 {
+	return dateWrapper(vals, args, enh, func(t time.Time) float64 {
 		return float64(t.Month())
 	})
 }
 
-// === year(v Vector) Scalar ===
+// === year(v Vector, tz String) Scalar ===
 func funcYear(vals []Value, args Expressions, enh *EvalNodeHelper) Vector {
-	return dateWrapper(vals, enh, func(t time.Time) float64 {
+	return dateWrapper(vals, args, enh, func(t time.Time) float64 {
 		return float64(t.Year())
 	})
 }
@@ -920,6 +1475,48 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcAbsent,
 	},
+	"absent_over_time": {
+		Name:       "absent_over_time",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		Call:       funcAbsentOverTime,
+	},
+	"acos": {
+		Name:       "acos",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcAcos,
+	},
+	"acosh": {
+		Name:       "acosh",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcAcosh,
+	},
+	"asin": {
+		Name:       "asin",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcAsin,
+	},
+	"asinh": {
+		Name:       "asinh",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcAsinh,
+	},
+	"atan": {
+		Name:       "atan",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcAtan,
+	},
+	"atanh": {
+		Name:       "atanh",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcAtanh,
+	},
 	"avg_over_time": {
 		Name:       "avg_over_time",
 		ArgTypes:   []ValueType{ValueTypeMatrix},
@@ -938,6 +1535,12 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcChanges,
 	},
+	"clamp": {
+		Name:       "clamp",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeScalar, ValueTypeScalar},
+		ReturnType: ValueTypeVector,
+		Call:       funcClamp,
+	},
 	"clamp_max": {
 		Name:       "clamp_max",
 		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeScalar},
@@ -950,6 +1553,18 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcClampMin,
 	},
+	"cos": {
+		Name:       "cos",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcCos,
+	},
+	"cosh": {
+		Name:       "cosh",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcCosh,
+	},
 	"count_over_time": {
 		Name:       "count_over_time",
 		ArgTypes:   []ValueType{ValueTypeMatrix},
@@ -958,25 +1573,38 @@ var functions = map[string]*Function{
 	},
 	"days_in_month": {
 		Name:       "days_in_month",
-		ArgTypes:   []ValueType{ValueTypeVector},
-		Variadic:   1,
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   2,
 		ReturnType: ValueTypeVector,
 		Call:       funcDaysInMonth,
 	},
 	"day_of_month": {
 		Name:       "day_of_month",
-		ArgTypes:   []ValueType{ValueTypeVector},
-		Variadic:   1,
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   2,
 		ReturnType: ValueTypeVector,
 		Call:       funcDayOfMonth,
 	},
 	"day_of_week": {
 		Name:       "day_of_week",
-		ArgTypes:   []ValueType{ValueTypeVector},
-		Variadic:   1,
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   2,
 		ReturnType: ValueTypeVector,
 		Call:       funcDayOfWeek,
 	},
+	"day_of_year": {
+		Name:       "day_of_year",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   2,
+		ReturnType: ValueTypeVector,
+		Call:       funcDayOfYear,
+	},
+	"deg": {
+		Name:       "deg",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcDeg,
+	},
 	"delta": {
 		Name:       "delta",
 		ArgTypes:   []ValueType{ValueTypeMatrix},
@@ -995,18 +1623,48 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcExp,
 	},
+	"first_over_time": {
+		Name:       "first_over_time",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		Call:       funcFirstOverTime,
+	},
 	"floor": {
 		Name:       "floor",
 		ArgTypes:   []ValueType{ValueTypeVector},
 		ReturnType: ValueTypeVector,
 		Call:       funcFloor,
 	},
+	"histogram_count": {
+		Name:       "histogram_count",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcHistogramCount,
+	},
+	"histogram_fraction": {
+		Name:       "histogram_fraction",
+		ArgTypes:   []ValueType{ValueTypeScalar, ValueTypeScalar, ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcHistogramFraction,
+	},
 	"histogram_quantile": {
 		Name:       "histogram_quantile",
 		ArgTypes:   []ValueType{ValueTypeScalar, ValueTypeVector},
 		ReturnType: ValueTypeVector,
 		Call:       funcHistogramQuantile,
 	},
+	"histogram_stddev": {
+		Name:       "histogram_stddev",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcHistogramStddev,
+	},
+	"histogram_sum": {
+		Name:       "histogram_sum",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcHistogramSum,
+	},
 	"holt_winters": {
 		Name:       "holt_winters",
 		ArgTypes:   []ValueType{ValueTypeMatrix, ValueTypeScalar, ValueTypeScalar},
@@ -1015,8 +1673,8 @@ var functions = map[string]*Function{
 	},
 	"hour": {
 		Name:       "hour",
-		ArgTypes:   []ValueType{ValueTypeVector},
-		Variadic:   1,
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   2,
 		ReturnType: ValueTypeVector,
 		Call:       funcHour,
 	},
@@ -1038,6 +1696,55 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcIrate,
 	},
+	"is_weekend": {
+		Name:       "is_weekend",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   2,
+		ReturnType: ValueTypeVector,
+		Call:       funcIsWeekend,
+	},
+	"label_copy": {
+		Name:       "label_copy",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString, ValueTypeString},
+		Variadic:   -1,
+		ReturnType: ValueTypeVector,
+		Call:       funcLabelCopy,
+	},
+	"label_del": {
+		Name:       "label_del",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   -1,
+		ReturnType: ValueTypeVector,
+		Call:       funcLabelDel,
+	},
+	"label_keep": {
+		Name:       "label_keep",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   -1,
+		ReturnType: ValueTypeVector,
+		Call:       funcLabelKeep,
+	},
+	"label_lowercase": {
+		Name:       "label_lowercase",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   -1,
+		ReturnType: ValueTypeVector,
+		Call:       funcLabelLowercase,
+	},
+	"label_move": {
+		Name:       "label_move",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString, ValueTypeString},
+		Variadic:   -1,
+		ReturnType: ValueTypeVector,
+		Call:       funcLabelMove,
+	},
+	"label_set": {
+		Name:       "label_set",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString, ValueTypeString},
+		Variadic:   -1,
+		ReturnType: ValueTypeVector,
+		Call:       funcLabelSet,
+	},
 	"label_replace": {
 		Name:       "label_replace",
 		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString, ValueTypeString, ValueTypeString, ValueTypeString},
@@ -1051,6 +1758,19 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcLabelJoin,
 	},
+	"label_uppercase": {
+		Name:       "label_uppercase",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   -1,
+		ReturnType: ValueTypeVector,
+		Call:       funcLabelUppercase,
+	},
+	"last_over_time": {
+		Name:       "last_over_time",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		Call:       funcLastOverTime,
+	},
 	"ln": {
 		Name:       "ln",
 		ArgTypes:   []ValueType{ValueTypeVector},
@@ -1069,6 +1789,12 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcLog2,
 	},
+	"mad_over_time": {
+		Name:       "mad_over_time",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		Call:       funcMadOverTime,
+	},
 	"max_over_time": {
 		Name:       "max_over_time",
 		ArgTypes:   []ValueType{ValueTypeMatrix},
@@ -1083,30 +1809,48 @@ var functions = map[string]*Function{
 	},
 	"minute": {
 		Name:       "minute",
-		ArgTypes:   []ValueType{ValueTypeVector},
-		Variadic:   1,
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   2,
 		ReturnType: ValueTypeVector,
 		Call:       funcMinute,
 	},
 	"month": {
 		Name:       "month",
-		ArgTypes:   []ValueType{ValueTypeVector},
-		Variadic:   1,
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   2,
 		ReturnType: ValueTypeVector,
 		Call:       funcMonth,
 	},
+	"pi": {
+		Name:       "pi",
+		ArgTypes:   []ValueType{},
+		ReturnType: ValueTypeScalar,
+		Call:       funcPi,
+	},
 	"predict_linear": {
 		Name:       "predict_linear",
 		ArgTypes:   []ValueType{ValueTypeMatrix, ValueTypeScalar},
 		ReturnType: ValueTypeVector,
 		Call:       funcPredictLinear,
 	},
+	"present_over_time": {
+		Name:       "present_over_time",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		Call:       funcPresentOverTime,
+	},
 	"quantile_over_time": {
 		Name:       "quantile_over_time",
 		ArgTypes:   []ValueType{ValueTypeScalar, ValueTypeMatrix},
 		ReturnType: ValueTypeVector,
 		Call:       funcQuantileOverTime,
 	},
+	"rad": {
+		Name:       "rad",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcRad,
+	},
 	"rate": {
 		Name:       "rate",
 		ArgTypes:   []ValueType{ValueTypeMatrix},
@@ -1132,6 +1876,24 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeScalar,
 		Call:       funcScalar,
 	},
+	"sgn": {
+		Name:       "sgn",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcSgn,
+	},
+	"sin": {
+		Name:       "sin",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcSin,
+	},
+	"sinh": {
+		Name:       "sinh",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcSinh,
+	},
 	"sort": {
 		Name:       "sort",
 		ArgTypes:   []ValueType{ValueTypeVector},
@@ -1144,6 +1906,20 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcSortDesc,
 	},
+	"sort_by_label": {
+		Name:       "sort_by_label",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   -1,
+		ReturnType: ValueTypeVector,
+		Call:       funcSortByLabel,
+	},
+	"sort_by_label_desc": {
+		Name:       "sort_by_label_desc",
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   -1,
+		ReturnType: ValueTypeVector,
+		Call:       funcSortByLabelDesc,
+	},
 	"sqrt": {
 		Name:       "sqrt",
 		ArgTypes:   []ValueType{ValueTypeVector},
@@ -1168,6 +1944,18 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcSumOverTime,
 	},
+	"tan": {
+		Name:       "tan",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcTan,
+	},
+	"tanh": {
+		Name:       "tanh",
+		ArgTypes:   []ValueType{ValueTypeVector},
+		ReturnType: ValueTypeVector,
+		Call:       funcTanh,
+	},
 	"time": {
 		Name:       "time",
 		ArgTypes:   []ValueType{},
@@ -1180,6 +1968,18 @@ var functions = map[string]*Function{
 		ReturnType: ValueTypeVector,
 		Call:       funcTimestamp,
 	},
+	"ts_of_max_over_time": {
+		Name:       "ts_of_max_over_time",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		Call:       funcTsOfMaxOverTime,
+	},
+	"ts_of_min_over_time": {
+		Name:       "ts_of_min_over_time",
+		ArgTypes:   []ValueType{ValueTypeMatrix},
+		ReturnType: ValueTypeVector,
+		Call:       funcTsOfMinOverTime,
+	},
 	"vector": {
 		Name:       "vector",
 		ArgTypes:   []ValueType{ValueTypeScalar},
@@ -1188,13 +1988,63 @@ var functions = map[string]*Function{
 	},
 	"year": {
 		Name:       "year",
-		ArgTypes:   []ValueType{ValueTypeVector},
-		Variadic:   1,
+		ArgTypes:   []ValueType{ValueTypeVector, ValueTypeString},
+		Variadic:   2,
 		ReturnType: ValueTypeVector,
 		Call:       funcYear,
 	},
 }
 
+// histogramFunctions are the functions that accept native histogram samples.
+// The histogram samples are removed from the arguments of all other functions.
+var histogramFunctions = map[string]bool{
+	"absent":             true,
+	"absent_over_time":   true,
+	"count_over_time":    true,
+	"histogram_count":    true,
+	"histogram_fraction": true,
+	"histogram_quantile": true,
+	"histogram_stddev":   true,
+	"histogram_sum":      true,
+	"increase":           true,
+	"label_copy":         true,
+	"label_del":          true,
+	"label_join":         true,
+	"label_keep":         true,
+	"label_lowercase":    true,
+	"label_move":         true,
+	"label_replace":      true,
+	"label_set":          true,
+	"label_uppercase":    true,
+	"present_over_time":  true,
+	"rate":               true,
+	"sort_by_label":      true,
+	"sort_by_label_desc": true,
+	"timestamp":          true,
+}
+
+// floatSamples removes the histogram samples from vec in place.
+func floatSamples(vec Vector) Vector {
+	out := vec[:0]
+	for _, s := range vec {
+		if s.H == nil {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// floatPoints removes the histogram points from points in place.
+func floatPoints(points []Point) []Point {
+	out := points[:0]
+	for _, p := range points {
+		if p.H == nil {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 // getFunction returns a predefined Function object for the given name.
 func getFunction(name string) (*Function, bool) {
 	function, ok := functions[name]
@@ -59,7 +59,7 @@ func (i ItemType) isAggregator() bool { return i > aggregatorsStart && i < aggre
 // isAggregator returns true if the item is an aggregator that takes a parameter.
 // Returns false otherwise
 func (i ItemType) isAggregatorWithParam() bool {
-	return i == itemTopK || i == itemBottomK || i == itemCountValues || i == itemQuantile
+	return i == itemTopK || i == itemBottomK || i == itemCountValues || i == itemQuantile || i == itemLimitK || i == itemLimitRatio
 }
 
 // isKeyword returns true if the item corresponds to a keyword.
@@ -102,7 +102,7 @@ func (i ItemType) precedence() int {
 		return 3
 	case itemADD, itemSUB:
 		return 4
-	case itemMUL, itemDIV, itemMOD:
+	case itemMUL, itemDIV, itemMOD, itemATAN2:
 		return 5
 	case itemPOW:
 		return 6
@@ -137,6 +137,8 @@ const (
 	itemRightBracket
 	itemComma
 	itemAssign
+	itemColon
+	itemAT
 	itemSemicolon
 	itemString
 	itemNumber
@@ -144,6 +146,8 @@ const (
 	itemBlank
 	itemTimes
 	itemSpace
+	itemStart
+	itemEnd
 
 	operatorsStart
 	// Operators.
@@ -164,6 +168,7 @@ const (
 	itemEQLRegex
 	itemNEQRegex
 	itemPOW
+	itemATAN2
 	operatorsEnd
 
 	aggregatorsStart
@@ -179,6 +184,9 @@ const (
 	itemBottomK
 	itemCountValues
 	itemQuantile
+	itemGroup
+	itemLimitK
+	itemLimitRatio
 	aggregatorsEnd
 
 	keywordsStart
@@ -204,6 +212,7 @@ var key = map[string]ItemType{
 	"and":    itemLAND,
 	"or":     itemLOR,
 	"unless": itemLUnless,
+	"atan2":  itemATAN2,
 
 	// Aggregators.
 	"sum":          itemSum,
@@ -217,6 +226,9 @@ var key = map[string]ItemType{
 	"bottomk":      itemBottomK,
 	"count_values": itemCountValues,
 	"quantile":     itemQuantile,
+	"group":        itemGroup,
+	"limitk":       itemLimitK,
+	"limit_ratio":  itemLimitRatio,
 
 	// Keywords.
 	"alert":       itemAlert,
@@ -245,10 +257,14 @@ var itemTypeStr = map[ItemType]string{
 	itemRightBracket: "]",
 	itemComma:        ",",
 	itemAssign:       "=",
+	itemColon:        ":",
+	itemAT:           "@",
 	itemSemicolon:    ";",
 	itemBlank:        "_",
 	itemTimes:        "x",
 	itemSpace:        "<space>",
+	itemStart:        "start",
+	itemEnd:          "end",
 
 	itemSUB:      "-",
 	itemADD:      "+",
@@ -336,6 +352,7 @@ type lexer struct {
 	parenDepth  int  // Nesting depth of ( ) exprs.
 	braceOpen   bool // Whether a { is opened.
 	bracketOpen bool // Whether a [ is opened.
+	gotColon    bool // Whether we got a ':' after [ was opened.
 	stringOpen  rune // Quote rune of the string currently being read.
 
 	// seriesDesc is set when a series description for the testing
@@ -481,6 +498,8 @@ func lexStatements(l *lexer) stateFn {
 		l.emit(itemSUB)
 	case r == '^':
 		l.emit(itemPOW)
+	case r == '@':
+		l.emit(itemAT)
 	case r == '=':
 		if t := l.peek(); t == '=' {
 			l.next()
@@ -519,6 +538,12 @@ func lexStatements(l *lexer) stateFn {
 	case r == '`':
 		l.stringOpen = r
 		return lexRawString
+	case r == ':' && l.bracketOpen:
+		if l.gotColon {
+			return l.errorf("unexpected colon %q", r)
+		}
+		l.emit(itemColon)
+		l.gotColon = true
 	case isAlpha(r) || r == ':':
 		l.backup()
 		return lexKeywordOrIdentifier
@@ -541,6 +566,7 @@ func lexStatements(l *lexer) stateFn {
 		if l.bracketOpen {
 			return l.errorf("unexpected left bracket %q", r)
 		}
+		l.gotColon = false
 		l.emit(itemLeftBracket)
 		l.bracketOpen = true
 		return lexDuration
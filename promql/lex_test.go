@@ -42,6 +42,21 @@ var tests = []struct {
 			{itemDuration, 1, `5m`},
 			{itemRightBracket, 3, `]`},
 		},
+	}, {
+		input: "[1h:5m]",
+		expected: []item{
+			{itemLeftBracket, 0, `[`},
+			{itemDuration, 1, `1h`},
+			{itemColon, 3, `:`},
+			{itemDuration, 4, `5m`},
+			{itemRightBracket, 6, `]`},
+		},
+	}, {
+		input: "@ 10",
+		expected: []item{
+			{itemAT, 0, `@`},
+			{itemNumber, 2, `10`},
+		},
 	}, {
 		input:    "\r\n\r",
 		expected: []item{},
@@ -223,6 +238,9 @@ var tests = []struct {
 	}, {
 		input:    `unless`,
 		expected: []item{{itemLUnless, 0, `unless`}},
+	}, {
+		input:    `atan2`,
+		expected: []item{{itemATAN2, 0, `atan2`}},
 	},
 	// Test aggregators.
 	{
@@ -266,6 +284,9 @@ var tests = []struct {
 	}, {
 		input:    "offset",
 		expected: []item{{itemOffset, 0, "offset"}},
+	}, {
+		input:    "offset -1h",
+		expected: []item{{itemOffset, 0, "offset"}, {itemSUB, 7, "-"}, {itemDuration, 8, "1h"}},
 	}, {
 		input:    "by",
 		expected: []item{{itemBy, 0, "by"}},
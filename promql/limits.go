@@ -0,0 +1,130 @@
+package promql
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// Limits are the ceilings applied to the queries of a tenant. A zero value
+// disables the respective limit, for MaxSamples and Timeout the engine's
+// default is used instead.
+type Limits struct {
+	// MaxQueryRange is the maximum time range between start and end of a
+	// range query.
+	MaxQueryRange time.Duration
+	// MaxQueryLookback is how far into the past, relative to the current
+	// time, a query may select data.
+	MaxQueryLookback time.Duration
+	// MaxSeriesPerSelector is the maximum number of series a single selector
+	// may select.
+	MaxSeriesPerSelector int
+	// MaxSamples is the maximum number of samples a query may load into
+	// memory at once.
+	MaxSamples int
+	// MaxResultSeries is the maximum number of series of a query result.
+	MaxResultSeries int
+	// Timeout is the maximum time a query may take.
+	Timeout time.Duration
+}
+
+// LimitsFunc returns the limits of the given tenant.
+type LimitsFunc func(tenant string) Limits
+
+type (
+	// ErrQueryRangeTooLong is returned if the time range of a query exceeds
+	// the tenant's limit.
+	ErrQueryRangeTooLong string
+	// ErrQueryLookbackTooLong is returned if a query selects data further in
+	// the past than the tenant's limit.
+	ErrQueryLookbackTooLong string
+	// ErrTooManySeriesPerSelector is returned if a selector selects more
+	// series than the tenant's limit.
+	ErrTooManySeriesPerSelector string
+	// ErrTooManyResultSeries is returned if the result of a query has more
+	// series than the tenant's limit.
+	ErrTooManyResultSeries string
+)
+
+func (e ErrQueryRangeTooLong) Error() string {
+	return fmt.Sprintf("query time range exceeds the limit of %s", string(e))
+}
+func (e ErrQueryLookbackTooLong) Error() string {
+	return fmt.Sprintf("query selects data older than the limit of %s", string(e))
+}
+func (e ErrTooManySeriesPerSelector) Error() string {
+	return fmt.Sprintf("selector %s selects more series than the limit", string(e))
+}
+func (e ErrTooManyResultSeries) Error() string {
+	return fmt.Sprintf("query result has more series than the limit of %s", string(e))
+}
+
+// limits returns the limits of the tenant with the engine's defaults applied.
+func (ng *Engine) limits(tenant string) Limits {
+	var l Limits
+	if ng.limitsFunc != nil {
+		l = ng.limitsFunc(tenant)
+	}
+	if l.MaxSamples <= 0 {
+		l.MaxSamples = ng.maxSamplesPerQuery
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = ng.timeout
+	}
+	return l
+}
+
+// CheckRangeQuery returns an error if the range query exceeds the range or
+// lookback limit of the tenant, or if its result has more series than
+// allowed. It serves results assembled from several evaluations, such as
+// those of a results cache, which the engine only checks in parts. A nil
+// result is not checked.
+func (ng *Engine) CheckRangeQuery(tenant string, expr Expr, start, end time.Time, interval time.Duration, res Matrix) error {
+	s := &EvalStmt{Expr: expr, Start: start, End: end, Interval: interval}
+	l := ng.limits(tenant)
+	if err := l.checkRange(s); err != nil {
+		return err
+	}
+	mint, _ := selectRange(s)
+	if err := l.checkLookback(mint); err != nil {
+		return err
+	}
+	if res != nil {
+		return l.checkResult(res)
+	}
+	return nil
+}
+
+// checkRange returns an error if the statement's time range exceeds the
+// limits.
+func (l Limits) checkRange(s *EvalStmt) error {
+	if l.MaxQueryRange > 0 && s.End.Sub(s.Start) > l.MaxQueryRange {
+		return ErrQueryRangeTooLong(model.Duration(l.MaxQueryRange).String())
+	}
+	return nil
+}
+
+// checkLookback returns an error if data before mint may not be selected.
+func (l Limits) checkLookback(mint time.Time) error {
+	if l.MaxQueryLookback > 0 && mint.Before(time.Now().Add(-l.MaxQueryLookback)) {
+		return ErrQueryLookbackTooLong(model.Duration(l.MaxQueryLookback).String())
+	}
+	return nil
+}
+
+// checkSeries returns an error if the selector selected too many series.
+func (l Limits) checkSeries(n Node, series int) error {
+	if l.MaxSeriesPerSelector > 0 && series > l.MaxSeriesPerSelector {
+		return ErrTooManySeriesPerSelector(n.String())
+	}
+	return nil
+}
+
+// checkResult returns an error if the result has too many series.
+func (l Limits) checkResult(mat Matrix) error {
+	if l.MaxResultSeries > 0 && len(mat) > l.MaxResultSeries {
+		return ErrTooManyResultSeries(fmt.Sprint(l.MaxResultSeries))
+	}
+	return nil
+}
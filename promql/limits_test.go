@@ -0,0 +1,69 @@
+package promql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/pkg/tenant"
+	"github.com/lwangrabbit/promql-sdk/storage"
+)
+
+func TestLimits(t *testing.T) {
+	h := storage.NewHead(time.Hour, 0)
+	app, err := h.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ts := int64(0); ts <= 600000; ts += 15000 {
+		app.Add(labels.FromStrings(labels.MetricName, "up", "job", "a"), ts, 1)
+		app.Add(labels.FromStrings(labels.MetricName, "up", "job", "b"), ts, 1)
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	ng := NewEngine(EngineOpts{
+		MaxConcurrent: 1,
+		MaxSamples:    10000,
+		Timeout:       time.Minute,
+		Limits: func(tenant string) Limits {
+			switch tenant {
+			case "range":
+				return Limits{MaxQueryRange: 5 * time.Minute}
+			case "lookback":
+				return Limits{MaxQueryLookback: time.Hour}
+			case "selector":
+				return Limits{MaxSeriesPerSelector: 1}
+			case "result":
+				return Limits{MaxResultSeries: 1}
+			}
+			return Limits{}
+		},
+	})
+	for _, c := range []struct {
+		tenant, query string
+		start         int64
+		err           error
+	}{
+		{tenant: "range", query: `up`, start: 0, err: ErrQueryRangeTooLong("5m")},
+		{tenant: "range", query: `up`, start: 300},
+		{tenant: "lookback", query: `up`, start: 300, err: ErrQueryLookbackTooLong("1h")},
+		{tenant: "selector", query: `sum(up)`, start: 300, err: ErrTooManySeriesPerSelector(`up`)},
+		{tenant: "selector", query: `rate(up[5m])`, start: 300, err: ErrTooManySeriesPerSelector(`up[5m]`)},
+		{tenant: "selector", query: `up{job="a"}`, start: 300},
+		{tenant: "result", query: `up`, start: 300, err: ErrTooManyResultSeries("1")},
+		{tenant: "result", query: `sum(up)`, start: 300},
+	} {
+		q, err := ng.NewRangeQuery(h, c.query, time.Unix(c.start, 0), time.Unix(600, 0), time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := q.Exec(tenant.WithID(context.Background(), c.tenant))
+		if res.Err != c.err {
+			t.Fatalf("%s of %s: expected error %v, got %v", c.query, c.tenant, c.err, res.Err)
+		}
+		q.Close()
+	}
+}
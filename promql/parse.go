@@ -555,7 +555,7 @@ func (p *parser) balance(lhs Expr, op ItemType, rhs Expr, vecMatching *VectorMat
 
 // unaryExpr parses a unary expression.
 //
-//		<Vector_selector> | <Matrix_selector> | (+|-) <number_literal> | '(' <expr> ')'
+//		<Vector_selector> | <Matrix_selector> | <subquery> | (+|-) <number_literal> | '(' <expr> ')'
 //
 func (p *parser) unaryExpr() Expr {
 	switch t := p.peek(); t.typ {
@@ -571,68 +571,207 @@ func (p *parser) unaryExpr() Expr {
 			return nl
 		}
 		return &UnaryExpr{Op: t.typ, Expr: e}
+	}
 
-	case itemLeftParen:
+	var e Expr
+	if p.peek().typ == itemLeftParen {
 		p.next()
-		e := p.expr()
+		e = &ParenExpr{Expr: p.expr()}
 		p.expect(itemRightParen, "paren expression")
-
-		return &ParenExpr{Expr: e}
+	} else {
+		e = p.primaryExpr()
 	}
-	e := p.primaryExpr()
 
-	// Expression might be followed by a range selector.
+	// Expression might be followed by a range or subquery selector.
 	if p.peek().typ == itemLeftBracket {
-		vs, ok := e.(*VectorSelector)
-		if !ok {
-			p.errorf("range specification must be preceded by a metric selector, but follows a %T instead", e)
+		e = p.subqueryOrRangeSelector(e, true)
+	}
+	p.modifiers(e)
+
+	// A subquery might be followed by further subqueries.
+	for p.peek().typ == itemLeftBracket {
+		e = p.subqueryOrRangeSelector(e, false)
+		p.modifiers(e)
+	}
+
+	return e
+}
+
+// modifiers parses the optional offset and @ modifiers of the given
+// expression. Each of them may be given at most once, in any order.
+//
+//		<expr> [offset <duration>] [@ <timestamp> | @ start() | @ end()]
+//
+func (p *parser) modifiers(e Expr) {
+	var gotOffset, gotAt bool
+	for {
+		switch p.peek().typ {
+		case itemOffset:
+			if gotOffset {
+				p.errorf("offset may not be set multiple times")
+			}
+			gotOffset = true
+			p.offsetModifier(e)
+		case itemAT:
+			if gotAt {
+				p.errorf("@ <timestamp> may not be set multiple times")
+			}
+			gotAt = true
+			p.atModifier(e)
+		default:
+			return
 		}
-		e = p.rangeSelector(vs)
 	}
+}
+
+// offsetModifier parses an offset of the given expression.
+func (p *parser) offsetModifier(e Expr) {
+	offset := p.offset()
+
+	switch s := e.(type) {
+	case *VectorSelector:
+		s.Offset = offset
+	case *MatrixSelector:
+		s.Offset = offset
+	case *SubqueryExpr:
+		s.Offset = offset
+	default:
+		// The offset of any other expression shifts the selectors and
+		// subqueries it is evaluated from. Functions depending on the
+		// evaluation time only, such as time(), are not shifted. As for a
+		// single selector, an offset may only be set once.
+		Inspect(e, func(node Node, path []Node) error {
+			for _, n := range path {
+				if _, ok := n.(*SubqueryExpr); ok {
+					// The subquery itself is shifted already.
+					return nil
+				}
+			}
+			var o *time.Duration
+			switch n := node.(type) {
+			case *VectorSelector:
+				o = &n.Offset
+			case *MatrixSelector:
+				o = &n.Offset
+			case *SubqueryExpr:
+				o = &n.Offset
+			default:
+				return nil
+			}
+			if *o != 0 {
+				p.errorf("offset may not be set multiple times")
+			}
+			*o = offset
+			return nil
+		})
+	}
+}
+
+// atModifier parses an @ modifier of the given expression.
+//
+//		'@' ['+' | '-'] <number> | '@' start '(' ')' | '@' end '(' ')'
+//
+func (p *parser) atModifier(e Expr) {
+	const ctx = "@ modifier"
 
-	// Parse optional offset.
-	if p.peek().typ == itemOffset {
-		offset := p.offset()
+	p.next()
 
-		switch s := e.(type) {
-		case *VectorSelector:
-			s.Offset = offset
-		case *MatrixSelector:
-			s.Offset = offset
+	var (
+		ts         *int64
+		startOrEnd ItemType
+		sign       = 1.0
+	)
+	if t := p.peek(); t.typ == itemADD || t.typ == itemSUB {
+		p.next()
+		if t.typ == itemSUB {
+			sign = -1
+		}
+		p.expect(itemNumber, ctx)
+		p.backup()
+	}
+
+	switch t := p.expectOneOf(itemNumber, itemIdentifier, ctx); t.typ {
+	case itemIdentifier:
+		switch t.val {
+		case "start":
+			startOrEnd = itemStart
+		case "end":
+			startOrEnd = itemEnd
 		default:
-			p.errorf("offset modifier must be preceded by an instant or range selector, but follows a %T instead", e)
+			p.errorf("unexpected %s in %s, expected start or end", t.desc(), ctx)
+		}
+		p.expect(itemLeftParen, ctx)
+		p.expect(itemRightParen, ctx)
+	default:
+		f := sign * p.number(t.val)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			p.errorf("timestamp out of bounds for %s: %f", ctx, f)
 		}
+		v := int64(math.Round(f * 1000))
+		ts = &v
 	}
 
-	return e
+	switch s := e.(type) {
+	case *VectorSelector:
+		s.Timestamp, s.StartOrEnd = ts, startOrEnd
+	case *MatrixSelector:
+		s.Timestamp, s.StartOrEnd = ts, startOrEnd
+	case *SubqueryExpr:
+		s.Timestamp, s.StartOrEnd = ts, startOrEnd
+	default:
+		p.errorf("@ modifier must be preceded by an instant or range selector or a subquery, but follows a %T instead", e)
+	}
 }
 
-// rangeSelector parses a Matrix (a.k.a. range) selector based on a given
-// Vector selector.
+// subqueryOrRangeSelector parses a Matrix (a.k.a. range) selector based on a
+// given Vector selector or a subquery of the given expression. Range
+// selectors are only parsed if checkRange is set.
 //
 //		<Vector_selector> '[' <duration> ']'
+//		<expr> '[' <duration> ':' [<duration>] ']'
 //
-func (p *parser) rangeSelector(vs *VectorSelector) *MatrixSelector {
-	const ctx = "range selector"
+func (p *parser) subqueryOrRangeSelector(expr Expr, checkRange bool) Expr {
+	ctx := "subquery selector"
+	if checkRange {
+		ctx = "range/subquery selector"
+	}
 	p.next()
 
-	var erange time.Duration
-	var err error
-
-	erangeStr := p.expect(itemDuration, ctx).val
-	erange, err = parseDuration(erangeStr)
+	erange, err := parseDuration(p.expect(itemDuration, ctx).val)
 	if err != nil {
 		p.error(err)
 	}
 
-	p.expect(itemRightBracket, ctx)
+	if checkRange {
+		if p.expectOneOf(itemRightBracket, itemColon, ctx).typ == itemRightBracket {
+			vs, ok := expr.(*VectorSelector)
+			if !ok {
+				p.errorf("range specification must be preceded by a metric selector, but follows a %T instead", expr)
+			}
+			return &MatrixSelector{
+				Name:          vs.Name,
+				LabelMatchers: vs.LabelMatchers,
+				Range:         erange,
+			}
+		}
+	} else {
+		p.expect(itemColon, ctx)
+	}
+
+	var estep time.Duration
+	if t := p.expectOneOf(itemRightBracket, itemDuration, ctx); t.typ == itemDuration {
+		estep, err = parseDuration(t.val)
+		if err != nil {
+			p.error(err)
+		}
+		p.expect(itemRightBracket, ctx)
+	}
 
-	e := &MatrixSelector{
-		Name:          vs.Name,
-		LabelMatchers: vs.LabelMatchers,
-		Range:         erange,
+	return &SubqueryExpr{
+		Expr:  expr,
+		Range: erange,
+		Step:  estep,
 	}
-	return e
 }
 
 // number parses a number.
@@ -935,6 +1074,13 @@ func (p *parser) offset() time.Duration {
 	const ctx = "offset"
 
 	p.next()
+	sign := time.Duration(1)
+	if t := p.peek(); t.typ == itemADD || t.typ == itemSUB {
+		p.next()
+		if t.typ == itemSUB {
+			sign = -1
+		}
+	}
 	offi := p.expect(itemDuration, ctx)
 
 	offset, err := parseDuration(offi.val)
@@ -942,7 +1088,7 @@ func (p *parser) offset() time.Duration {
 		p.error(err)
 	}
 
-	return offset
+	return sign * offset
 }
 
 // VectorSelector parses a new (instant) vector selector.
@@ -1053,7 +1199,7 @@ func (p *parser) checkType(node Node) (typ ValueType) {
 			p.errorf("aggregation operator expected in aggregation expression but got %q", n.Op)
 		}
 		p.expectType(n.Expr, ValueTypeVector, "aggregation expression")
-		if n.Op == itemTopK || n.Op == itemBottomK || n.Op == itemQuantile {
+		if n.Op == itemTopK || n.Op == itemBottomK || n.Op == itemQuantile || n.Op == itemLimitK || n.Op == itemLimitRatio {
 			p.expectType(n.Param, ValueTypeScalar, "aggregation parameter")
 		}
 		if n.Op == itemCountValues {
@@ -1100,10 +1246,13 @@ func (p *parser) checkType(node Node) (typ ValueType) {
 			}
 		} else {
 			na := nargs - 1
+			if n.Func.Variadic > 0 {
+				na = nargs - n.Func.Variadic
+			}
 			if na > len(n.Args) {
 				p.errorf("expected at least %d argument(s) in call to %q, got %d", na, n.Func.Name, len(n.Args))
-			} else if nargsmax := na + n.Func.Variadic; n.Func.Variadic > 0 && nargsmax < len(n.Args) {
-				p.errorf("expected at most %d argument(s) in call to %q, got %d", nargsmax, n.Func.Name, len(n.Args))
+			} else if n.Func.Variadic > 0 && nargs < len(n.Args) {
+				p.errorf("expected at most %d argument(s) in call to %q, got %d", nargs, n.Func.Name, len(n.Args))
 			}
 		}
 
@@ -1113,10 +1262,22 @@ func (p *parser) checkType(node Node) (typ ValueType) {
 			}
 			p.expectType(arg, n.Func.ArgTypes[i], fmt.Sprintf("call to function %q", n.Func.Name))
 		}
+		if dateFunctions[n.Func.Name] && len(n.Args) > 1 {
+			if tz, ok := n.Args[1].(*StringLiteral); ok {
+				if _, err := time.LoadLocation(tz.Val); err != nil {
+					p.errorf("invalid time zone %q in call to function %q", tz.Val, n.Func.Name)
+				}
+			}
+		}
 
 	case *ParenExpr:
 		p.checkType(n.Expr)
 
+	case *SubqueryExpr:
+		if t := p.checkType(n.Expr); t != ValueTypeVector {
+			p.errorf("subquery is only allowed on instant vector, got %s in %q instead", documentedType(t), n.String())
+		}
+
 	case *UnaryExpr:
 		if n.Op != itemADD && n.Op != itemSUB {
 			p.errorf("only + and - operators allowed for unary expressions")
@@ -0,0 +1,102 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	// A list of invalid expressions and a part of the error expected for
+	// each.
+	inputs := []struct {
+		in, err string
+	}{
+		{
+			in:  `x[5m][1h:1m]`,
+			err: "subquery is only allowed on instant vector, got range vector",
+		},
+		{
+			in:  `rate(x[5m])[1h:1m][1h:1m]`,
+			err: "subquery is only allowed on instant vector, got range vector",
+		},
+		{
+			in:  `x[1h:1m`,
+			err: "unclosed left bracket",
+		},
+		{
+			in:  `(x) @ 10`,
+			err: "@ modifier must be preceded by an instant or range selector or a subquery",
+		},
+		{
+			in:  `sum(x) @ 10`,
+			err: "@ modifier must be preceded by an instant or range selector or a subquery",
+		},
+		{
+			in:  `x @ 10 @ 20`,
+			err: "@ <timestamp> may not be set multiple times",
+		},
+		{
+			in:  `x[5m:1m] @ start() @ 10`,
+			err: "@ <timestamp> may not be set multiple times",
+		},
+		{
+			in:  `x @ start`,
+			err: `unexpected end of input in @ modifier, expected "("`,
+		},
+		{
+			in:  `x @ foo()`,
+			err: `unexpected identifier "foo" in @ modifier, expected start or end`,
+		},
+		{
+			in:  `x offset 1m offset 2m`,
+			err: "offset may not be set multiple times",
+		},
+		{
+			in:  `x[5m] offset -1m offset -1m`,
+			err: "offset may not be set multiple times",
+		},
+		{
+			in:  `x[5m:1m] offset 1m offset 1m`,
+			err: "offset may not be set multiple times",
+		},
+		{
+			in:  `hour(x, "Mars/Olympus_Mons")`,
+			err: `invalid time zone "Mars/Olympus_Mons" in call to function "hour"`,
+		},
+		{
+			in:  `(x offset 1h) offset 1h`,
+			err: "offset may not be set multiple times",
+		},
+		{
+			in:  `(a + rate(b[5m] offset 5m)) offset -1h`,
+			err: "offset may not be set multiple times",
+		},
+		{
+			in:  `sum(x[5m:1m] offset 1m) offset 1m`,
+			err: "offset may not be set multiple times",
+		},
+	}
+
+	for _, test := range inputs {
+		_, err := ParseExpr(test.in)
+		if err == nil {
+			t.Fatalf("expected an error for %q", test.in)
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error for %q to contain %q, got %q", test.in, test.err, err)
+		}
+	}
+}
@@ -76,6 +76,9 @@ func tree(node Node, level string) string {
 	case *ParenExpr:
 		t += tree(n.Expr, level)
 
+	case *SubqueryExpr:
+		t += tree(n.Expr, level)
+
 	case *UnaryExpr:
 		t += tree(n.Expr, level)
 
@@ -190,11 +193,9 @@ func (node *MatrixSelector) String() string {
 		Name:          node.Name,
 		LabelMatchers: node.LabelMatchers,
 	}
-	offset := ""
-	if node.Offset != time.Duration(0) {
-		offset = fmt.Sprintf(" offset %s", model.Duration(node.Offset))
-	}
-	return fmt.Sprintf("%s[%s]%s", vecSelector.String(), model.Duration(node.Range), offset)
+	offset := offsetString(node.Offset)
+	at := atString(node.Timestamp, node.StartOrEnd)
+	return fmt.Sprintf("%s[%s]%s%s", vecSelector.String(), model.Duration(node.Range), at, offset)
 }
 
 func (node *NumberLiteral) String() string {
@@ -209,6 +210,16 @@ func (node *StringLiteral) String() string {
 	return fmt.Sprintf("%q", node.Val)
 }
 
+func (node *SubqueryExpr) String() string {
+	step := ""
+	if node.Step != 0 {
+		step = model.Duration(node.Step).String()
+	}
+	offset := offsetString(node.Offset)
+	at := atString(node.Timestamp, node.StartOrEnd)
+	return fmt.Sprintf("%s[%s:%s]%s%s", node.Expr, model.Duration(node.Range), step, at, offset)
+}
+
 func (node *UnaryExpr) String() string {
 	return fmt.Sprintf("%s%s", node.Op, node.Expr)
 }
@@ -222,14 +233,37 @@ func (node *VectorSelector) String() string {
 		}
 		labelStrings = append(labelStrings, matcher.String())
 	}
-	offset := ""
-	if node.Offset != time.Duration(0) {
-		offset = fmt.Sprintf(" offset %s", model.Duration(node.Offset))
-	}
+	offset := offsetString(node.Offset)
+	at := atString(node.Timestamp, node.StartOrEnd)
 
 	if len(labelStrings) == 0 {
-		return fmt.Sprintf("%s%s", node.Name, offset)
+		return fmt.Sprintf("%s%s%s", node.Name, at, offset)
 	}
 	sort.Strings(labelStrings)
-	return fmt.Sprintf("%s{%s}%s", node.Name, strings.Join(labelStrings, ","), offset)
+	return fmt.Sprintf("%s{%s}%s%s", node.Name, strings.Join(labelStrings, ","), at, offset)
+}
+
+// offsetString returns the string representation of an offset modifier,
+// which is empty for a zero offset.
+func offsetString(offset time.Duration) string {
+	switch {
+	case offset > 0:
+		return fmt.Sprintf(" offset %s", model.Duration(offset))
+	case offset < 0:
+		return fmt.Sprintf(" offset -%s", model.Duration(-offset))
+	}
+	return ""
+}
+
+// atString returns the string representation of an @ modifier, which is
+// empty if none is set. start() and end() take precedence over the
+// timestamp they have been resolved to.
+func atString(ts *int64, startOrEnd ItemType) string {
+	switch {
+	case startOrEnd == itemStart || startOrEnd == itemEnd:
+		return fmt.Sprintf(" @ %s()", startOrEnd)
+	case ts != nil:
+		return fmt.Sprintf(" @ %.3f", float64(*ts)/1000)
+	}
+	return ""
 }
@@ -113,6 +113,48 @@ func TestExprString(t *testing.T) {
 		{
 			in: `a[5m] offset 1m`,
 		},
+		{
+			in: `max_over_time(rate(a[5m])[1h:1m])`,
+		},
+		{
+			in: `min_over_time((a + b)[30m:] offset 5m)`,
+		},
+		{
+			in: `min_over_time(max_over_time(rate(a[5m])[1h:1m])[1d:1h] offset 1h)`,
+		},
+		{
+			in:  `a offset 1m @ 10`,
+			out: `a @ 10.000 offset 1m`,
+		},
+		{
+			in: `rate(a[5m] @ -1.500)`,
+		},
+		{
+			in: `max_over_time(rate(a[5m])[1h:] @ end())`,
+		},
+		{
+			in: `a{b="c"} @ start() offset 5m`,
+		},
+		{
+			in: `a offset -1h`,
+		},
+		{
+			in: `a atan2 on(b) c`,
+		},
+		{
+			in: `group by(a) (b)`,
+		},
+		{
+			in: `limit_ratio(0.1, a)`,
+		},
+		{
+			in:  `(a + rate(b[5m])) offset -1h`,
+			out: `(a offset -1h + rate(b[5m] offset -1h))`,
+		},
+		{
+			in:  `sum(x) offset 1d`,
+			out: `sum(x offset 1d)`,
+		},
 	}
 
 	for _, test := range inputs {
@@ -127,6 +169,15 @@ func TestExprString(t *testing.T) {
 		if expr.String() != exp {
 			t.Fatalf("expected %q to be returned as:\n%s\ngot:\n%s\n", test.in, exp, expr.String())
 		}
+
+		// The returned expression must parse back to itself.
+		reparsed, err := ParseExpr(exp)
+		if err != nil {
+			t.Fatalf("parsing error for %q: %s", exp, err)
+		}
+		if reparsed.String() != exp {
+			t.Fatalf("expected %q to round-trip, got:\n%s\n", exp, reparsed.String())
+		}
 	}
 }
 
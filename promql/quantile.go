@@ -17,11 +17,45 @@ import (
 	"math"
 	"sort"
 
+	"github.com/lwangrabbit/promql-sdk/pkg/histogram"
 	"github.com/lwangrabbit/promql-sdk/pkg/labels"
 )
 
 // Helpers to calculate quantiles.
 
+// BucketInterpolation is the distribution of the observations within a
+// histogram bucket assumed when interpolating quantiles and fractions.
+type BucketInterpolation int
+
+const (
+	// LinearInterpolation assumes the observations of a bucket to be
+	// distributed evenly between its bounds.
+	LinearInterpolation BucketInterpolation = iota
+	// ExponentialInterpolation assumes the observations of a bucket to be
+	// distributed evenly between the logarithms of its bounds, which suits
+	// exponentially growing buckets better. Buckets with a lower bound of
+	// zero or less are interpolated linearly.
+	ExponentialInterpolation
+)
+
+// interpolate returns the position of v within the bucket (lower, upper] as
+// a fraction of the bucket's observations.
+func (i BucketInterpolation) interpolate(lower, upper, v float64) float64 {
+	if i == ExponentialInterpolation && lower > 0 {
+		return math.Log(v/lower) / math.Log(upper/lower)
+	}
+	return (v - lower) / (upper - lower)
+}
+
+// bound is the inverse of interpolate. It returns the value at the given
+// fraction of the observations of the bucket (lower, upper].
+func (i BucketInterpolation) bound(lower, upper, fraction float64) float64 {
+	if i == ExponentialInterpolation && lower > 0 {
+		return lower * math.Pow(upper/lower, fraction)
+	}
+	return lower + (upper-lower)*fraction
+}
+
 // excludedLabels are the labels to exclude from signature calculation for
 // quantiles.
 var excludedLabels = []string{
@@ -46,10 +80,9 @@ type metricWithBuckets struct {
 	buckets buckets
 }
 
-// bucketQuantile calculates the quantile 'q' based on the given buckets. The
-// buckets will be sorted by upperBound by this function (i.e. no sorting
-// needed before calling this function). The quantile value is interpolated
-// assuming a linear distribution within a bucket. However, if the quantile
+// bucketQuantile calculates the quantile 'q' based on the given buckets,
+// which must have been validated by validateBuckets. The quantile value is
+// interpolated within a bucket as given by interpolation. However, if the quantile
 // falls into the highest bucket, the upper bound of the 2nd highest bucket is
 // returned. A natural lower bound of 0 is assumed if the upper bound of the
 // lowest bucket is greater 0. In that case, interpolation in the lowest bucket
@@ -57,9 +90,8 @@ type metricWithBuckets struct {
 // However, if the lowest bucket has an upper bound less or equal 0, this upper
 // bound is returned if the quantile falls into the lowest bucket.
 //
-// There are a number of special cases (once we have a way to report errors
-// happening during evaluations of AST functions, we should report those
-// explicitly):
+// There are a number of special cases, which validateBuckets reports as
+// warnings:
 //
 // If 'buckets' has fewer than 2 elements, NaN is returned.
 //
@@ -68,7 +100,7 @@ type metricWithBuckets struct {
 // If q<0, -Inf is returned.
 //
 // If q>1, +Inf is returned.
-func bucketQuantile(q float64, buckets buckets) float64 {
+func bucketQuantile(q float64, buckets buckets, interpolation BucketInterpolation) float64 {
 	if q < 0 {
 		return math.Inf(-1)
 	}
@@ -78,13 +110,10 @@ func bucketQuantile(q float64, buckets buckets) float64 {
 	if len(buckets) < 2 {
 		return math.NaN()
 	}
-	sort.Sort(buckets)
 	if !math.IsInf(buckets[len(buckets)-1].upperBound, +1) {
 		return math.NaN()
 	}
 
-	ensureMonotonic(buckets)
-
 	rank := q * buckets[len(buckets)-1].count
 	b := sort.Search(len(buckets)-1, func(i int) bool { return buckets[i].count >= rank })
 
@@ -104,7 +133,65 @@ func bucketQuantile(q float64, buckets buckets) float64 {
 		count -= buckets[b-1].count
 		rank -= buckets[b-1].count
 	}
-	return bucketStart + (bucketEnd-bucketStart)*(rank/count)
+	return interpolation.bound(bucketStart, bucketEnd, rank/count)
+}
+
+// bucketFraction estimates the fraction of the observations of the given
+// buckets between lower and upper. The buckets must have been validated by
+// validateBuckets. As in bucketQuantile, the lowest bucket is assumed to start
+// at 0 if its upper bound is positive and the observations of the +Inf bucket
+// are assumed to be at the upper bound of the 2nd highest bucket.
+//
+// If 'buckets' has fewer than 2 elements or no +Inf bucket, or if it has no
+// observations, NaN is returned.
+func bucketFraction(lower, upper float64, buckets buckets, interpolation BucketInterpolation) float64 {
+	if len(buckets) < 2 || math.IsNaN(lower) || math.IsNaN(upper) {
+		return math.NaN()
+	}
+	if !math.IsInf(buckets[len(buckets)-1].upperBound, +1) {
+		return math.NaN()
+	}
+	count := buckets[len(buckets)-1].count
+	if count == 0 {
+		return math.NaN()
+	}
+	if lower >= upper {
+		return 0
+	}
+	return (bucketRank(upper, buckets, interpolation) - bucketRank(lower, buckets, interpolation)) / count
+}
+
+// bucketRank estimates the number of observations of the buckets less than or
+// equal to v.
+func bucketRank(v float64, buckets buckets, interpolation BucketInterpolation) float64 {
+	for i, b := range buckets {
+		if v >= b.upperBound {
+			continue
+		}
+		if i == 0 {
+			if b.upperBound <= 0 || v <= 0 {
+				return 0
+			}
+			return b.count * interpolation.interpolate(0, b.upperBound, v)
+		}
+		prev := buckets[i-1]
+		if math.IsInf(b.upperBound, +1) {
+			return prev.count
+		}
+		return prev.count + (b.count-prev.count)*interpolation.interpolate(prev.upperBound, b.upperBound, v)
+	}
+	return buckets[len(buckets)-1].count
+}
+
+// validateBuckets sorts the buckets by their upper bound and repairs bucket
+// counts that are not monotonic, see ensureMonotonic. It returns whether the
+// +Inf bucket is missing and whether counts were repaired.
+func validateBuckets(buckets buckets) (missingInf, repaired bool) {
+	sort.Sort(buckets)
+	if !math.IsInf(buckets[len(buckets)-1].upperBound, +1) {
+		return true, false
+	}
+	return false, ensureMonotonic(buckets)
 }
 
 // The assumption that bucket counts increase monotonically with increasing
@@ -140,16 +227,19 @@ func bucketQuantile(q float64, buckets buckets) float64 {
 // calculate the "envelope" of the histogram buckets, essentially removing
 // any decreases in the count between successive buckets.
 
-func ensureMonotonic(buckets buckets) {
+func ensureMonotonic(buckets buckets) bool {
+	var repaired bool
 	max := buckets[0].count
-	for i := range buckets[1:] {
+	for i := 1; i < len(buckets); i++ {
 		switch {
 		case buckets[i].count > max:
 			max = buckets[i].count
 		case buckets[i].count < max:
 			buckets[i].count = max
+			repaired = true
 		}
 	}
+	return repaired
 }
 
 // qauntile calculates the given quantile of a vector of samples.
@@ -181,3 +271,107 @@ func quantile(q float64, values vectorByValueHeap) float64 {
 	weight := rank - math.Floor(rank)
 	return values[int(lowerIndex)].V*(1-weight) + values[int(upperIndex)].V*weight
 }
+
+// histogramQuantile calculates the quantile 'q' of a native histogram by
+// linear interpolation within the bucket the quantile falls into. The same
+// special cases as in bucketQuantile apply.
+func histogramQuantile(q float64, h *histogram.FloatHistogram) float64 {
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(+1)
+	}
+	if h.Count == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	bs := histogramBuckets(h)
+	if len(bs) == 0 {
+		return math.NaN()
+	}
+
+	var (
+		rank  = q * h.Count
+		count float64
+	)
+	for _, b := range bs {
+		if b.Count <= 0 {
+			continue
+		}
+		if count+b.Count >= rank {
+			return b.Lower + (b.Upper-b.Lower)*((rank-count)/b.Count)
+		}
+		count += b.Count
+	}
+	// The bucket counts add up to less than the total count.
+	return bs[len(bs)-1].Upper
+}
+
+// histogramFraction estimates the fraction of the observations of a native
+// histogram between lower and upper, interpolating linearly within the
+// buckets.
+func histogramFraction(lower, upper float64, h *histogram.FloatHistogram) float64 {
+	if h.Count == 0 || math.IsNaN(lower) || math.IsNaN(upper) {
+		return math.NaN()
+	}
+	if lower >= upper {
+		return 0
+	}
+
+	var rank float64
+	for _, b := range histogramBuckets(h) {
+		lo, hi := math.Max(lower, b.Lower), math.Min(upper, b.Upper)
+		switch {
+		case lower <= b.Lower && b.Upper <= upper:
+			rank += b.Count
+		case lo < hi:
+			rank += b.Count * (hi - lo) / (b.Upper - b.Lower)
+		}
+	}
+	return rank / h.Count
+}
+
+// histogramStddev estimates the standard deviation of the observations of a
+// native histogram. The observations of a bucket are assumed to be at its
+// geometric mean, those of the zero bucket at zero.
+func histogramStddev(h *histogram.FloatHistogram) float64 {
+	if h.Count == 0 {
+		return math.NaN()
+	}
+	var (
+		mean     = h.Sum / h.Count
+		variance float64
+	)
+	for _, b := range h.Buckets() {
+		var v float64
+		switch {
+		case b.Lower > 0:
+			v = math.Sqrt(b.Lower * b.Upper)
+		case b.Upper < 0:
+			v = -math.Sqrt(b.Lower * b.Upper)
+		}
+		delta := v - mean
+		variance += b.Count * delta * delta
+	}
+	return math.Sqrt(variance / h.Count)
+}
+
+// histogramBuckets returns the buckets of a native histogram. The zero bucket
+// is limited to the non-negative values if there are only positive buckets
+// and vice versa, so that interpolation does not yield values of the wrong
+// sign.
+func histogramBuckets(h *histogram.FloatHistogram) []histogram.Bucket {
+	bs := h.Buckets()
+	for i, b := range bs {
+		if b.Lower >= 0 || b.Upper <= 0 {
+			continue
+		}
+		switch {
+		case len(h.NegativeBuckets) == 0 && len(h.PositiveBuckets) > 0:
+			bs[i].Lower = 0
+		case len(h.PositiveBuckets) == 0 && len(h.NegativeBuckets) > 0:
+			bs[i].Upper = 0
+		}
+	}
+	return bs
+}
@@ -0,0 +1,95 @@
+package promql
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/tenant"
+	"github.com/lwangrabbit/promql-sdk/util/stats"
+)
+
+// QueryLogEntry describes an executed query.
+type QueryLogEntry struct {
+	Expr      string            `json:"expr"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	Step      float64           `json:"step"` // Step in seconds, zero for instant queries.
+	Tenant    string            `json:"tenant,omitempty"`
+	Duration  float64           `json:"duration"` // Duration in seconds.
+	Stats     *stats.QueryStats `json:"stats"`
+	Samples   int               `json:"samples"`
+	Series    int               `json:"series"`
+	Endpoints []string          `json:"endpoints,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// QueryLogger receives an entry for every logged query. Implementations
+// must be safe for concurrent use.
+type QueryLogger interface {
+	Log(QueryLogEntry)
+}
+
+// QueryLoggerFunc is an adapter to allow the use of ordinary functions as
+// query loggers.
+type QueryLoggerFunc func(QueryLogEntry)
+
+// Log implements QueryLogger.
+func (f QueryLoggerFunc) Log(e QueryLogEntry) {
+	f(e)
+}
+
+// jsonQueryLogger writes entries as JSON lines.
+type jsonQueryLogger struct {
+	mtx sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONQueryLogger returns a QueryLogger writing an entry per line as JSON
+// to w, for example a rotating file of the logfile package.
+func NewJSONQueryLogger(w io.Writer) QueryLogger {
+	return &jsonQueryLogger{enc: json.NewEncoder(w)}
+}
+
+// Log implements QueryLogger. Write errors are dropped.
+func (l *jsonQueryLogger) Log(e QueryLogEntry) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.enc.Encode(e)
+}
+
+// logQuery passes the executed query to the query logger if it took at
+// least the slow query threshold.
+func (ng *Engine) logQuery(ctx context.Context, q *query, start time.Time, err error) {
+	if ng.queryLogger == nil {
+		return
+	}
+	d := time.Since(start)
+	if d < ng.slowQueryThreshold {
+		return
+	}
+	s, ok := q.stmt.(*EvalStmt)
+	if !ok {
+		return
+	}
+	e := QueryLogEntry{
+		Expr:     s.Expr.String(),
+		Start:    s.Start,
+		End:      s.End,
+		Step:     s.Interval.Seconds(),
+		Tenant:   tenant.FromContext(ctx),
+		Duration: d.Seconds(),
+		Stats:    stats.NewQueryStats(q.stats),
+		Samples:  q.samples,
+		Series:   q.series,
+	}
+	if q.endpoints != nil {
+		e.Endpoints = q.endpoints.Names()
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	ng.queryLogger.Log(e)
+}
@@ -0,0 +1,84 @@
+package promql
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/tenant"
+)
+
+// RunningQuery describes a query that is currently being executed.
+type RunningQuery struct {
+	ID        uint64    `json:"id"`
+	Expr      string    `json:"expr"`
+	Tenant    string    `json:"tenant,omitempty"`
+	StartTime time.Time `json:"startTime"`
+}
+
+// Age returns for how long the query has been running.
+func (q RunningQuery) Age() time.Duration {
+	return time.Since(q.StartTime)
+}
+
+type runningQuery struct {
+	RunningQuery
+	query *query
+}
+
+func (ng *Engine) nextQueryID() uint64 {
+	return atomic.AddUint64(&ng.lastQueryID, 1)
+}
+
+// register adds the query to the running queries.
+func (ng *Engine) register(ctx context.Context, q *query) {
+	ng.runningMtx.Lock()
+	defer ng.runningMtx.Unlock()
+	ng.runningQueries[q.id] = &runningQuery{
+		RunningQuery: RunningQuery{
+			ID:        q.id,
+			Expr:      q.stmt.String(),
+			Tenant:    tenant.FromContext(ctx),
+			StartTime: time.Now(),
+		},
+		query: q,
+	}
+}
+
+// deregister removes the query from the running queries.
+func (ng *Engine) deregister(q *query) {
+	ng.runningMtx.Lock()
+	defer ng.runningMtx.Unlock()
+	delete(ng.runningQueries, q.id)
+}
+
+// RunningQueries returns the queries that are currently executed, including
+// the ones waiting in the queue, ordered by their start time.
+func (ng *Engine) RunningQueries() []RunningQuery {
+	ng.runningMtx.Lock()
+	queries := make([]RunningQuery, 0, len(ng.runningQueries))
+	for _, rq := range ng.runningQueries {
+		queries = append(queries, rq.RunningQuery)
+	}
+	ng.runningMtx.Unlock()
+
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].StartTime.Before(queries[j].StartTime)
+	})
+	return queries
+}
+
+// CancelQuery cancels the running query with the given ID. It returns false
+// if no such query is running. The cancellation aborts the evaluation and
+// in-flight reads from remote endpoints.
+func (ng *Engine) CancelQuery(id uint64) bool {
+	ng.runningMtx.Lock()
+	rq, ok := ng.runningQueries[id]
+	ng.runningMtx.Unlock()
+	if !ok {
+		return false
+	}
+	rq.query.Cancel()
+	return true
+}
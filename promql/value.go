@@ -19,6 +19,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/lwangrabbit/promql-sdk/pkg/histogram"
 	"github.com/lwangrabbit/promql-sdk/pkg/labels"
 )
 
@@ -81,6 +82,33 @@ type Series struct {
 	Points []Point       `json:"values"`
 }
 
+// MarshalJSON implements json.Marshaler. The float and histogram points of
+// the series are listed separately as values and histograms.
+func (s Series) MarshalJSON() ([]byte, error) {
+	var floats, hists []Point
+	for _, p := range s.Points {
+		if p.H != nil {
+			hists = append(hists, p)
+		} else {
+			floats = append(floats, p)
+		}
+	}
+	if hists == nil {
+		type series Series
+		return json.Marshal(series(s))
+	}
+	v := struct {
+		M labels.Labels `json:"metric"`
+		V []Point       `json:"values,omitempty"`
+		H []Point       `json:"histograms"`
+	}{
+		M: s.Metric,
+		V: floats,
+		H: hists,
+	}
+	return json.Marshal(v)
+}
+
 func (s Series) String() string {
 	vals := make([]string, len(s.Points))
 	for i, v := range s.Points {
@@ -89,23 +117,64 @@ func (s Series) String() string {
 	return fmt.Sprintf("%s =>\n%s", s.Metric, strings.Join(vals, "\n"))
 }
 
-// Point represents a single data point for a given timestamp.
+// Point represents a single data point for a given timestamp. If H is set,
+// the point is a native histogram and V is ignored.
 type Point struct {
 	T int64
 	V float64
+	H *histogram.FloatHistogram
 }
 
 func (p Point) String() string {
+	if p.H != nil {
+		return fmt.Sprintf("%s @[%v]", p.H, p.T)
+	}
 	v := strconv.FormatFloat(p.V, 'f', -1, 64)
 	return fmt.Sprintf("%v @[%v]", v, p.T)
 }
 
 // MarshalJSON implements json.Marshaler.
 func (p Point) MarshalJSON() ([]byte, error) {
+	if p.H != nil {
+		return json.Marshal([...]interface{}{float64(p.T) / 1000, marshalHistogram(p.H)})
+	}
 	v := strconv.FormatFloat(p.V, 'f', -1, 64)
 	return json.Marshal([...]interface{}{float64(p.T) / 1000, v})
 }
 
+// histogramJSON is the JSON representation of a native histogram. Each bucket
+// is encoded as [boundaries, lower, upper, count], where boundaries is 0 for
+// buckets open on the left, 1 for buckets open on the right and 3 for the zero
+// bucket, which is closed on both sides.
+type histogramJSON struct {
+	Count   string           `json:"count"`
+	Sum     string           `json:"sum"`
+	Buckets [][4]interface{} `json:"buckets,omitempty"`
+}
+
+func marshalHistogram(h *histogram.FloatHistogram) histogramJSON {
+	res := histogramJSON{
+		Count: strconv.FormatFloat(h.Count, 'f', -1, 64),
+		Sum:   strconv.FormatFloat(h.Sum, 'f', -1, 64),
+	}
+	for _, b := range h.Buckets() {
+		boundaries := 3
+		switch {
+		case b.Lower > 0:
+			boundaries = 0
+		case b.Upper < 0:
+			boundaries = 1
+		}
+		res.Buckets = append(res.Buckets, [4]interface{}{
+			boundaries,
+			strconv.FormatFloat(b.Lower, 'f', -1, 64),
+			strconv.FormatFloat(b.Upper, 'f', -1, 64),
+			strconv.FormatFloat(b.Count, 'f', -1, 64),
+		})
+	}
+	return res
+}
+
 // Sample is a single sample belonging to a metric.
 type Sample struct {
 	Point
@@ -118,6 +187,16 @@ func (s Sample) String() string {
 }
 
 func (s Sample) MarshalJSON() ([]byte, error) {
+	if s.H != nil {
+		h := struct {
+			M labels.Labels `json:"metric"`
+			H Point         `json:"histogram"`
+		}{
+			M: s.Metric,
+			H: s.Point,
+		}
+		return json.Marshal(h)
+	}
 	v := struct {
 		M labels.Labels `json:"metric"`
 		V Point         `json:"value"`
@@ -203,6 +282,9 @@ func (m Matrix) ContainsSameLabelset() bool {
 type Result struct {
 	Err   error
 	Value Value
+	// Warnings are problems with the input data that did not fail the
+	// query, such as invalid histogram buckets.
+	Warnings []string
 }
 
 // Vector returns a Vector if the result value is one. An error is returned if
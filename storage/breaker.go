@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a client whose circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// breaker rejects requests for a cooldown period after a number of
+// consecutive failed requests. Once the cooldown has passed, requests are let
+// through again: the next failure reopens it and a success closes it.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mtx       sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether a request may be sent at now.
+func (b *breaker) allow(now time.Time) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return !now.Before(b.openUntil)
+}
+
+// record records the outcome of a request and reports whether it opened the
+// breaker.
+func (b *breaker) record(failed bool, now time.Time) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if !failed {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return false
+	}
+	b.failures++
+	if b.failures < b.threshold || now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
@@ -15,6 +15,8 @@ package storage
 
 import (
 	"math"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/histogram"
 )
 
 // BufferedSeriesIterator wraps an iterator with a look-back buffer.
@@ -66,9 +68,9 @@ func (b *BufferedSeriesIterator) ReduceDelta(delta int64) bool {
 	return true
 }
 
-// PeekBack returns the nth previous element of the iterator. If there is none buffered,
-// ok is false.
-func (b *BufferedSeriesIterator) PeekBack(n int) (t int64, v float64, ok bool) {
+// PeekBack returns the nth previous element of the iterator. h is set if the
+// element is a histogram. If there is none buffered, ok is false.
+func (b *BufferedSeriesIterator) PeekBack(n int) (t int64, v float64, h *histogram.FloatHistogram, ok bool) {
 	return b.buf.nthLast(n)
 }
 
@@ -113,7 +115,8 @@ func (b *BufferedSeriesIterator) Next() bool {
 	}
 
 	// Add current element to buffer before advancing.
-	b.buf.add(b.it.At())
+	t, v := b.it.At()
+	b.buf.add(t, v, HistogramAt(b.it))
 
 	b.ok = b.it.Next()
 	if b.ok {
@@ -128,6 +131,13 @@ func (b *BufferedSeriesIterator) Values() (int64, float64) {
 	return b.it.At()
 }
 
+// AtHistogram returns the current element of the iterator if it is a
+// histogram.
+func (b *BufferedSeriesIterator) AtHistogram() (int64, *histogram.FloatHistogram) {
+	t, _ := b.it.At()
+	return t, HistogramAt(b.it)
+}
+
 // Err returns the last encountered error.
 func (b *BufferedSeriesIterator) Err() error {
 	return b.it.Err()
@@ -136,6 +146,7 @@ func (b *BufferedSeriesIterator) Err() error {
 type sample struct {
 	t int64
 	v float64
+	h *histogram.FloatHistogram
 }
 
 type sampleRing struct {
@@ -188,18 +199,23 @@ func (it *sampleRingIterator) Err() error {
 }
 
 func (it *sampleRingIterator) At() (int64, float64) {
-	return it.r.at(it.i)
+	s := it.r.at(it.i)
+	return s.t, s.v
 }
 
-func (r *sampleRing) at(i int) (int64, float64) {
+func (it *sampleRingIterator) AtHistogram() (int64, *histogram.FloatHistogram) {
+	s := it.r.at(it.i)
+	return s.t, s.h
+}
+
+func (r *sampleRing) at(i int) sample {
 	j := (r.f + i) % len(r.buf)
-	s := r.buf[j]
-	return s.t, s.v
+	return r.buf[j]
 }
 
 // add adds a sample to the ring buffer and frees all samples that fall
 // out of the delta range.
-func (r *sampleRing) add(t int64, v float64) {
+func (r *sampleRing) add(t int64, v float64, h *histogram.FloatHistogram) {
 	l := len(r.buf)
 	// Grow the ring buffer if it fits no more elements.
 	if l == r.l {
@@ -218,7 +234,7 @@ func (r *sampleRing) add(t int64, v float64) {
 		}
 	}
 
-	r.buf[r.i] = sample{t: t, v: v}
+	r.buf[r.i] = sample{t: t, v: v, h: h}
 	r.l++
 
 	// Free head of the buffer of samples that just fell out of the range.
@@ -232,12 +248,12 @@ func (r *sampleRing) add(t int64, v float64) {
 }
 
 // nthLast returns the nth most recent element added to the ring.
-func (r *sampleRing) nthLast(n int) (int64, float64, bool) {
+func (r *sampleRing) nthLast(n int) (int64, float64, *histogram.FloatHistogram, bool) {
 	if n > r.l {
-		return 0, 0, false
+		return 0, 0, nil, false
 	}
-	t, v := r.at(r.l - n)
-	return t, v, true
+	s := r.at(r.l - n)
+	return s.t, s.v, s.h, true
 }
 
 func (r *sampleRing) samples() []sample {
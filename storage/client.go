@@ -9,14 +9,19 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 	"golang.org/x/net/context/ctxhttp"
 
+	"github.com/lwangrabbit/promql-sdk/pkg/singleflight"
+	"github.com/lwangrabbit/promql-sdk/pkg/tracing"
 	"github.com/lwangrabbit/promql-sdk/prompb"
 )
 
@@ -28,6 +33,15 @@ type Client struct {
 	url     *config_util.URL
 	client  *http.Client
 	timeout time.Duration
+
+	// Identical concurrent reads are coalesced into a single request if
+	// coalesce is set.
+	coalesce bool
+	reads    singleflight.Group
+
+	maxRetries int
+	breaker    breaker
+	metrics    *clientMetrics
 }
 
 // ClientConfig configures a Client.
@@ -35,6 +49,20 @@ type ClientConfig struct {
 	URL              *config_util.URL
 	Timeout          model.Duration
 	HTTPClientConfig config_util.HTTPClientConfig
+
+	// Reg optionally registers the metrics of the client.
+	Reg prometheus.Registerer
+	// MaxRetries is the number of times a read is retried after a network
+	// error or a 5xx response.
+	MaxRetries int
+	// BreakerThreshold is the number of consecutive failed reads after which
+	// reads are rejected for BreakerCooldown. Zero disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// CoalesceReads makes identical concurrent reads share a single request,
+	// which carries the context values, such as the tracing span, of the
+	// first caller.
+	CoalesceReads bool
 }
 
 // NewClient creates a new Client.
@@ -50,10 +78,17 @@ func NewClient(index int, conf *ClientConfig) (*Client, error) {
 	}
 
 	return &Client{
-		index:   index,
-		url:     conf.URL,
-		client:  httpClient,
-		timeout: time.Duration(conf.Timeout),
+		index:      index,
+		url:        conf.URL,
+		client:     httpClient,
+		timeout:    time.Duration(conf.Timeout),
+		maxRetries: conf.MaxRetries,
+		coalesce:   conf.CoalesceReads,
+		breaker: breaker{
+			threshold: conf.BreakerThreshold,
+			cooldown:  conf.BreakerCooldown,
+		},
+		metrics: newClientMetrics(conf.Reg, index, conf.URL.Redacted()),
 	}, nil
 }
 
@@ -106,7 +141,7 @@ func (c *Client) Store(ctx context.Context, req *prompb.WriteRequest) error {
 }
 
 // Name identifies the client.
-func (c Client) Name() string {
+func (c *Client) Name() string {
 	return fmt.Sprintf("%d:%s", c.index, c.url)
 }
 
@@ -124,46 +159,183 @@ func (c *Client) Read(ctx context.Context, query *prompb.Query) (*prompb.QueryRe
 		return nil, fmt.Errorf("unable to marshal read request: %v", err)
 	}
 
+	recordEndpoint(ctx, c.url.Redacted())
+
+	var rr *readResult
+	if c.coalesce {
+		// Concurrent callers share the result, which must not be modified.
+		res, _, err := c.reads.Do(ctx, string(data), func(ctx context.Context) (interface{}, error) {
+			return c.read(ctx, query, data)
+		})
+		if err != nil {
+			return nil, err
+		}
+		rr = res.(*readResult)
+	} else {
+		rr, err = c.read(ctx, query, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	recordEndpointBytes(ctx, c.url.Redacted(), rr.size)
+	return rr.res, nil
+}
+
+// readResult is the result of a read and the size of its compressed
+// response.
+type readResult struct {
+	res  *prompb.QueryResult
+	size int
+}
+
+// read sends the marshaled read request to the remote endpoint, retrying
+// recoverable errors until the circuit breaker opens.
+func (c *Client) read(ctx context.Context, query *prompb.Query, data []byte) (*readResult, error) {
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.allow(time.Now()) {
+			c.metrics.breakerRejected.Inc()
+			return nil, ErrCircuitOpen
+		}
+		res, size, err := c.readOnce(ctx, query, data)
+		if err != nil && ctx.Err() != nil {
+			// Canceled or timed out queries say nothing about the
+			// endpoint and are not recorded by the breaker.
+			return nil, ctx.Err()
+		}
+		rerr, recoverable := err.(recoverableError)
+		if c.breaker.record(recoverable, time.Now()) {
+			c.metrics.breakerOpened.Inc()
+		}
+		if err == nil {
+			return &readResult{res: res, size: size}, nil
+		}
+		if !recoverable {
+			return nil, err
+		}
+		if attempt >= c.maxRetries || ctx.Err() != nil {
+			return nil, rerr.error
+		}
+		c.metrics.retries.Inc()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(retryBackoff(attempt)):
+		}
+	}
+}
+
+// retryBackoff returns the time to wait before the retry following the given
+// attempt.
+func retryBackoff(attempt int) time.Duration {
+	d := 100 * time.Millisecond << uint(attempt)
+	if d > 5*time.Second || d <= 0 {
+		d = 5 * time.Second
+	}
+	return d
+}
+
+// readOnce sends a single read request and returns the result and the size
+// of the compressed response. Network errors and 5xx responses are returned
+// as recoverableError.
+func (c *Client) readOnce(ctx context.Context, query *prompb.Query, data []byte) (res *prompb.QueryResult, size int, err error) {
+	span, ctx := tracing.StartSpan(ctx, "remote_read")
+	span.SetAttribute("endpoint", c.url.Redacted())
+	span.SetAttribute("matchers", matchersString(query.Matchers))
+	span.SetAttribute("start", query.StartTimestampMs)
+	span.SetAttribute("end", query.EndTimestampMs)
+	c.metrics.inFlight.Inc()
+	start := time.Now()
+	defer func() {
+		c.metrics.inFlight.Dec()
+		c.metrics.requestDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			span.RecordError(err)
+		} else {
+			span.SetAttribute("series", len(res.Timeseries))
+		}
+		span.End()
+	}()
+
 	compressed := snappy.Encode(nil, data)
 	httpReq, err := http.NewRequest("POST", c.url.String(), bytes.NewReader(compressed))
 	if err != nil {
-		return nil, fmt.Errorf("unable to create request: %v", err)
+		return nil, 0, fmt.Errorf("unable to create request: %v", err)
 	}
 	httpReq.Header.Add("Content-Encoding", "snappy")
 	httpReq.Header.Add("Accept-Encoding", "snappy")
 	httpReq.Header.Set("Content-Type", "application/x-protobuf")
 	httpReq.Header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
 
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	reqCtx, cancel := context.WithTimeout(ctx, c.timeout)
 	defer cancel()
 
-	httpResp, err := ctxhttp.Do(ctx, c.client, httpReq)
+	httpResp, err := ctxhttp.Do(reqCtx, c.client, httpReq)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %v", err)
+		if ctx.Err() != nil {
+			// The query was canceled or timed out, the endpoint did not
+			// fail.
+			return nil, 0, ctx.Err()
+		}
+		c.metrics.requests.WithLabelValues("error").Inc()
+		return nil, 0, recoverableError{fmt.Errorf("error sending request: %v", err)}
 	}
 	defer httpResp.Body.Close()
+	span.SetAttribute("status_code", httpResp.StatusCode)
+	c.metrics.requests.WithLabelValues(strconv.Itoa(httpResp.StatusCode)).Inc()
+	if httpResp.StatusCode/100 == 5 {
+		return nil, 0, recoverableError{fmt.Errorf("server returned HTTP status %s", httpResp.Status)}
+	}
 	if httpResp.StatusCode/100 != 2 {
-		return nil, fmt.Errorf("server returned HTTP status %s", httpResp.Status)
+		return nil, 0, fmt.Errorf("server returned HTTP status %s", httpResp.Status)
 	}
 
 	compressed, err = ioutil.ReadAll(httpResp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response: %v", err)
+		return nil, 0, fmt.Errorf("error reading response: %v", err)
 	}
+	span.SetAttribute("response_bytes", len(compressed))
+	c.metrics.compressedBytes.Observe(float64(len(compressed)))
 
 	uncompressed, err := snappy.Decode(nil, compressed)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response: %v", err)
+		return nil, 0, fmt.Errorf("error reading response: %v", err)
 	}
+	c.metrics.decompressedBytes.Observe(float64(len(uncompressed)))
 
 	var resp prompb.ReadResponse
 	err = proto.Unmarshal(uncompressed, &resp)
 	if err != nil {
-		return nil, fmt.Errorf("unable to unmarshal response body: %v", err)
+		return nil, 0, fmt.Errorf("unable to unmarshal response body: %v", err)
 	}
 
-	if len(resp.Results) != len(req.Queries) {
-		return nil, fmt.Errorf("responses: want %d, got %d", len(req.Queries), len(resp.Results))
+	if len(resp.Results) != 1 {
+		return nil, 0, fmt.Errorf("responses: want %d, got %d", 1, len(resp.Results))
+	}
+	var samples int
+	for _, ts := range resp.Results[0].Timeseries {
+		samples += len(ts.Samples) + len(ts.Histograms)
+	}
+	c.metrics.series.Observe(float64(len(resp.Results[0].Timeseries)))
+	c.metrics.samples.Observe(float64(samples))
+	return resp.Results[0], len(compressed), nil
+}
+
+// matchersString formats the matchers of a query like a selector.
+func matchersString(ms []*prompb.LabelMatcher) string {
+	strs := make([]string, 0, len(ms))
+	for _, m := range ms {
+		var op string
+		switch m.Type {
+		case prompb.LabelMatcher_EQ:
+			op = "="
+		case prompb.LabelMatcher_NEQ:
+			op = "!="
+		case prompb.LabelMatcher_RE:
+			op = "=~"
+		case prompb.LabelMatcher_NRE:
+			op = "!~"
+		}
+		strs = append(strs, fmt.Sprintf("%s%s%q", m.Name, op, m.Value))
 	}
-	return resp.Results[0], nil
+	return "{" + strings.Join(strs, ",") + "}"
 }
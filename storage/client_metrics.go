@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "prometheus"
+	subsystem = "remote_read_client"
+)
+
+// clientMetrics are the metrics of a single remote read endpoint.
+type clientMetrics struct {
+	requestDuration   prometheus.Histogram
+	requests          *prometheus.CounterVec
+	compressedBytes   prometheus.Histogram
+	decompressedBytes prometheus.Histogram
+	series            prometheus.Histogram
+	samples           prometheus.Histogram
+	inFlight          prometheus.Gauge
+	retries           prometheus.Counter
+	breakerOpened     prometheus.Counter
+	breakerRejected   prometheus.Counter
+}
+
+// newClientMetrics creates the metrics of the client with the given index
+// and URL and registers them on reg, if not nil. Clients sharing a registerer
+// are told apart by their endpoint and url labels.
+func newClientMetrics(reg prometheus.Registerer, index int, url string) *clientMetrics {
+	constLabels := prometheus.Labels{"endpoint": strconv.Itoa(index), "url": url}
+	m := &clientMetrics{
+		requestDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "request_duration_seconds",
+			Help:        "Duration of remote read requests.",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: constLabels,
+		}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "requests_total",
+			Help:        "Remote read requests by HTTP status code, \"error\" if no response was received.",
+			ConstLabels: constLabels,
+		}, []string{"code"}),
+		compressedBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "response_compressed_bytes",
+			Help:        "Size of the snappy compressed remote read responses.",
+			Buckets:     prometheus.ExponentialBuckets(1024, 4, 10),
+			ConstLabels: constLabels,
+		}),
+		decompressedBytes: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "response_decompressed_bytes",
+			Help:        "Size of the decompressed remote read responses.",
+			Buckets:     prometheus.ExponentialBuckets(1024, 4, 10),
+			ConstLabels: constLabels,
+		}),
+		series: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "response_series",
+			Help:        "Number of series in the remote read responses.",
+			Buckets:     prometheus.ExponentialBuckets(1, 4, 10),
+			ConstLabels: constLabels,
+		}),
+		samples: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "response_samples",
+			Help:        "Number of samples in the remote read responses.",
+			Buckets:     prometheus.ExponentialBuckets(100, 4, 10),
+			ConstLabels: constLabels,
+		}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "requests_in_flight",
+			Help:        "Number of remote read requests in flight.",
+			ConstLabels: constLabels,
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "retries_total",
+			Help:        "Remote read requests retried after a recoverable error.",
+			ConstLabels: constLabels,
+		}),
+		breakerOpened: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "circuit_breaker_opened_total",
+			Help:        "Times the circuit breaker opened after consecutive failures.",
+			ConstLabels: constLabels,
+		}),
+		breakerRejected: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   subsystem,
+			Name:        "circuit_breaker_rejected_total",
+			Help:        "Remote read requests rejected by the open circuit breaker.",
+			ConstLabels: constLabels,
+		}),
+	}
+	if reg != nil {
+		reg.MustRegister(
+			m.requestDuration,
+			m.requests,
+			m.compressedBytes,
+			m.decompressedBytes,
+			m.series,
+			m.samples,
+			m.inFlight,
+			m.retries,
+			m.breakerOpened,
+			m.breakerRejected,
+		)
+	}
+	return m
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	config_util "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+
+	"github.com/lwangrabbit/promql-sdk/prompb"
+)
+
+func TestClientRetriesAndBreaker(t *testing.T) {
+	var requests int
+	down := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if down || requests == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		data, _ := proto.Marshal(&prompb.ReadResponse{Results: []*prompb.QueryResult{{
+			Timeseries: []*prompb.TimeSeries{{
+				Labels:  []*prompb.Label{{Name: "__name__", Value: "up"}},
+				Samples: []prompb.Sample{{Timestamp: 0, Value: 1}},
+			}},
+		}}})
+		w.Write(snappy.Encode(nil, data))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	reg := prometheus.NewRegistry()
+	c, err := NewClient(3, &ClientConfig{
+		URL:              &config_util.URL{URL: u},
+		Timeout:          model.Duration(time.Second),
+		Reg:              reg,
+		MaxRetries:       3,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Read(context.Background(), &prompb.Query{StartTimestampMs: 0, EndTimestampMs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Timeseries) != 1 {
+		t.Fatalf("expected 1 series, got %d", len(res.Timeseries))
+	}
+	if n := testutil.ToFloat64(c.metrics.retries); n != 1 {
+		t.Fatalf("expected 1 retry, got %v", n)
+	}
+	if n := testutil.ToFloat64(c.metrics.requests.WithLabelValues("503")); n != 1 {
+		t.Fatalf("expected 1 failed request, got %v", n)
+	}
+
+	// The breaker opens on the second attempt and stops the retries.
+	down = true
+	if _, err := c.Read(context.Background(), &prompb.Query{StartTimestampMs: 2, EndTimestampMs: 3}); err != ErrCircuitOpen {
+		t.Fatalf("expected %v, got %v", ErrCircuitOpen, err)
+	}
+	if _, err := c.Read(context.Background(), &prompb.Query{StartTimestampMs: 3, EndTimestampMs: 4}); err != ErrCircuitOpen {
+		t.Fatalf("expected %v, got %v", ErrCircuitOpen, err)
+	}
+	if n := testutil.ToFloat64(c.metrics.breakerOpened); n != 1 {
+		t.Fatalf("expected the breaker to have opened once, got %v", n)
+	}
+	if requests != 4 {
+		t.Fatalf("expected 4 requests, got %d", requests)
+	}
+}
+
+func TestClientReadsNotCoalesced(t *testing.T) {
+	var (
+		requests = make(chan struct{}, 2)
+		release  = make(chan struct{})
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- struct{}{}
+		<-release
+		data, _ := proto.Marshal(&prompb.ReadResponse{Results: []*prompb.QueryResult{{}}})
+		w.Write(snappy.Encode(nil, data))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL)
+	c, err := NewClient(0, &ClientConfig{
+		URL:     &config_util.URL{URL: u},
+		Timeout: model.Duration(time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without CoalesceReads both identical reads reach the endpoint.
+	errs := make(chan error)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := c.Read(context.Background(), &prompb.Query{StartTimestampMs: 0, EndTimestampMs: 1})
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-requests:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected 2 concurrent requests")
+		}
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClientCanceledReadsKeepBreakerClosed(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	u, _ := url.Parse(server.URL)
+	c, err := NewClient(0, &ClientConfig{
+		URL:              &config_util.URL{URL: u},
+		Timeout:          model.Duration(time.Minute),
+		Reg:              prometheus.NewRegistry(),
+		MaxRetries:       3,
+		BreakerThreshold: 1,
+		BreakerCooldown:  time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := c.Read(ctx, &prompb.Query{StartTimestampMs: 0, EndTimestampMs: 1})
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("%d: expected %v, got %v", i, context.DeadlineExceeded, err)
+		}
+	}
+	if !c.breaker.allow(time.Now()) {
+		t.Fatal("expected the breaker to stay closed")
+	}
+	if n := testutil.ToFloat64(c.metrics.requests.WithLabelValues("error")); n != 0 {
+		t.Fatalf("expected no failed requests, got %v", n)
+	}
+	if n := testutil.ToFloat64(c.metrics.retries); n != 0 {
+		t.Fatalf("expected no retries, got %v", n)
+	}
+}
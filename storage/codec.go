@@ -2,14 +2,62 @@ package storage
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"sort"
 
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
 	"github.com/prometheus/common/model"
 
+	"github.com/lwangrabbit/promql-sdk/pkg/histogram"
 	"github.com/lwangrabbit/promql-sdk/pkg/labels"
 	"github.com/lwangrabbit/promql-sdk/prompb"
 )
 
+const (
+	// decodeReadLimit is the maximum size of a read request body in bytes.
+	decodeReadLimit = 32 * 1024 * 1024
+	// decodeWriteLimit is the maximum size of a write request body in bytes.
+	decodeWriteLimit = 32 * 1024 * 1024
+	// decodedWriteLimit is the maximum size of a decompressed write request
+	// in bytes.
+	decodedWriteLimit = 4 * decodeWriteLimit
+)
+
+// DecodeWriteRequest from an io.Reader into a prompb.WriteRequest, handling
+// snappy decompression. Bodies larger than decodeWriteLimit, or
+// decodedWriteLimit once decompressed, are rejected.
+func DecodeWriteRequest(r io.Reader) (*prompb.WriteRequest, error) {
+	compressed, err := ioutil.ReadAll(io.LimitReader(r, decodeWriteLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) > decodeWriteLimit {
+		return nil, fmt.Errorf("write request body exceeds %d bytes", decodeWriteLimit)
+	}
+	n, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, err
+	}
+	if n > decodedWriteLimit {
+		return nil, fmt.Errorf("decompressed write request exceeds %d bytes", decodedWriteLimit)
+	}
+
+	reqBuf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(reqBuf, &req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
 // ToQuery builds a Query proto.
 func ToQuery(from, to int64, matchers []*labels.Matcher, p *SelectParams) (*prompb.Query, error) {
 	ms, err := toLabelMatchers(matchers)
@@ -70,8 +118,9 @@ func FromQueryResult(res *prompb.QueryResult) SeriesSet {
 		}
 
 		series = append(series, &concreteSeries{
-			labels:  labels,
-			samples: ts.Samples,
+			labels:     labels,
+			samples:    ts.Samples,
+			histograms: histogramProtosToSamples(ts.Histograms),
 		})
 	}
 	sort.Sort(byLabel(series))
@@ -152,8 +201,15 @@ func (c *concreteSeriesSet) Err() error {
 
 // concreteSeries implements storage.Series.
 type concreteSeries struct {
-	labels  labels.Labels
-	samples []prompb.Sample
+	labels     labels.Labels
+	samples    []prompb.Sample
+	histograms []histogramSample
+}
+
+// histogramSample is a native histogram with its timestamp.
+type histogramSample struct {
+	t int64
+	h *histogram.FloatHistogram
 }
 
 func (c *concreteSeries) Labels() labels.Labels {
@@ -164,40 +220,285 @@ func (c *concreteSeries) Iterator() SeriesIterator {
 	return newConcreteSeriersIterator(c)
 }
 
-// concreteSeriesIterator implements storage.SeriesIterator.
+// concreteSeriesIterator implements storage.SeriesIterator. The float and
+// histogram samples of the series are merged by timestamp.
 type concreteSeriesIterator struct {
-	cur    int
-	series *concreteSeries
+	// Number of float and histogram samples consumed. The current sample
+	// is the last one consumed.
+	floats, hists int
+	hist          bool
+	series        *concreteSeries
 }
 
 func newConcreteSeriersIterator(series *concreteSeries) SeriesIterator {
 	return &concreteSeriesIterator{
-		cur:    -1,
 		series: series,
 	}
 }
 
 // Seek implements storage.SeriesIterator.
 func (c *concreteSeriesIterator) Seek(t int64) bool {
-	c.cur = sort.Search(len(c.series.samples), func(n int) bool {
+	c.floats = sort.Search(len(c.series.samples), func(n int) bool {
 		return c.series.samples[n].Timestamp >= t
 	})
-	return c.cur < len(c.series.samples)
+	c.hists = sort.Search(len(c.series.histograms), func(n int) bool {
+		return c.series.histograms[n].t >= t
+	})
+	return c.Next()
 }
 
 // At implements storage.SeriesIterator.
 func (c *concreteSeriesIterator) At() (t int64, v float64) {
-	s := c.series.samples[c.cur]
+	if c.hist {
+		return c.series.histograms[c.hists-1].t, 0
+	}
+	s := c.series.samples[c.floats-1]
 	return s.Timestamp, s.Value
 }
 
+// AtHistogram implements storage.HistogramIterator.
+func (c *concreteSeriesIterator) AtHistogram() (t int64, h *histogram.FloatHistogram) {
+	if !c.hist {
+		return c.series.samples[c.floats-1].Timestamp, nil
+	}
+	s := c.series.histograms[c.hists-1]
+	return s.t, s.h
+}
+
 // Next implements storage.SeriesIterator.
 func (c *concreteSeriesIterator) Next() bool {
-	c.cur++
-	return c.cur < len(c.series.samples)
+	floats, hists := c.series.samples, c.series.histograms
+	switch {
+	case c.floats < len(floats) && (c.hists == len(hists) || floats[c.floats].Timestamp <= hists[c.hists].t):
+		c.floats++
+		c.hist = false
+	case c.hists < len(hists):
+		c.hists++
+		c.hist = true
+	default:
+		return false
+	}
+	return true
 }
 
 // Err implements storage.SeriesIterator.
 func (c *concreteSeriesIterator) Err() error {
 	return nil
 }
+
+// DecodeReadRequest reads a remote.Request from a http.Request. Bodies larger
+// than decodeReadLimit are rejected.
+func DecodeReadRequest(r *http.Request) (*prompb.ReadRequest, error) {
+	compressed, err := ioutil.ReadAll(io.LimitReader(r.Body, decodeReadLimit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) > decodeReadLimit {
+		return nil, fmt.Errorf("read request body exceeds %d bytes", decodeReadLimit)
+	}
+
+	reqBuf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	var req prompb.ReadRequest
+	if err := proto.Unmarshal(reqBuf, &req); err != nil {
+		return nil, err
+	}
+
+	return &req, nil
+}
+
+// EncodeReadResponse writes a remote.Response to a http.ResponseWriter.
+func EncodeReadResponse(resp *prompb.ReadResponse, w http.ResponseWriter) error {
+	data, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+
+	compressed := snappy.Encode(nil, data)
+	_, err = w.Write(compressed)
+	return err
+}
+
+// FromQuery unpacks a Query proto.
+func FromQuery(req *prompb.Query) (int64, int64, []*labels.Matcher, *SelectParams, error) {
+	matchers, err := fromLabelMatchers(req.Matchers)
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	var selectParams *SelectParams
+	if req.Hints != nil {
+		selectParams = &SelectParams{
+			Start: req.Hints.StartMs,
+			End:   req.Hints.EndMs,
+			Step:  req.Hints.StepMs,
+			Func:  req.Hints.Func,
+		}
+	}
+
+	return req.StartTimestampMs, req.EndTimestampMs, matchers, selectParams, nil
+}
+
+func fromLabelMatchers(matchers []*prompb.LabelMatcher) ([]*labels.Matcher, error) {
+	result := make([]*labels.Matcher, 0, len(matchers))
+	for _, matcher := range matchers {
+		var mtype labels.MatchType
+		switch matcher.Type {
+		case prompb.LabelMatcher_EQ:
+			mtype = labels.MatchEqual
+		case prompb.LabelMatcher_NEQ:
+			mtype = labels.MatchNotEqual
+		case prompb.LabelMatcher_RE:
+			mtype = labels.MatchRegexp
+		case prompb.LabelMatcher_NRE:
+			mtype = labels.MatchNotRegexp
+		default:
+			return nil, fmt.Errorf("invalid matcher type")
+		}
+		m, err := labels.NewMatcher(mtype, matcher.Name, matcher.Value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+// ToQueryResult builds a QueryResult proto.
+func ToQueryResult(ss SeriesSet) (*prompb.QueryResult, error) {
+	resp := &prompb.QueryResult{}
+	for ss.Next() {
+		series := ss.At()
+		iter := series.Iterator()
+		samples := []prompb.Sample{}
+		var histograms []prompb.Histogram
+
+		for iter.Next() {
+			ts, val := iter.At()
+			if h := HistogramAt(iter); h != nil {
+				histograms = append(histograms, FloatHistogramToHistogramProto(ts, h))
+				continue
+			}
+			samples = append(samples, prompb.Sample{
+				Timestamp: ts,
+				Value:     val,
+			})
+		}
+		if err := iter.Err(); err != nil {
+			return nil, err
+		}
+
+		resp.Timeseries = append(resp.Timeseries, &prompb.TimeSeries{
+			Labels:     labelsToLabelsProto(series.Labels()),
+			Samples:    samples,
+			Histograms: histograms,
+		})
+	}
+	if err := ss.Err(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func labelsToLabelsProto(labels labels.Labels) []*prompb.Label {
+	result := make([]*prompb.Label, 0, len(labels))
+	for _, l := range labels {
+		result = append(result, &prompb.Label{
+			Name:  l.Name,
+			Value: l.Value,
+		})
+	}
+	return result
+}
+
+// HistogramProtoToFloatHistogram converts a histogram proto with either
+// integer or float counts to a FloatHistogram.
+func HistogramProtoToFloatHistogram(hp prompb.Histogram) *histogram.FloatHistogram {
+	h := &histogram.FloatHistogram{
+		Schema:          hp.Schema,
+		ZeroThreshold:   hp.ZeroThreshold,
+		Sum:             hp.Sum,
+		PositiveSpans:   spansProtoToSpans(hp.PositiveSpans),
+		NegativeSpans:   spansProtoToSpans(hp.NegativeSpans),
+		PositiveBuckets: hp.PositiveCounts,
+		NegativeBuckets: hp.NegativeCounts,
+	}
+	if _, ok := hp.Count.(*prompb.Histogram_CountInt); ok {
+		h.Count = float64(hp.GetCountInt())
+	} else {
+		h.Count = hp.GetCountFloat()
+	}
+	if _, ok := hp.ZeroCount.(*prompb.Histogram_ZeroCountInt); ok {
+		h.ZeroCount = float64(hp.GetZeroCountInt())
+	} else {
+		h.ZeroCount = hp.GetZeroCountFloat()
+	}
+	if len(hp.PositiveDeltas) > 0 {
+		h.PositiveBuckets = deltasToCounts(hp.PositiveDeltas)
+	}
+	if len(hp.NegativeDeltas) > 0 {
+		h.NegativeBuckets = deltasToCounts(hp.NegativeDeltas)
+	}
+	return h
+}
+
+// FloatHistogramToHistogramProto converts a FloatHistogram to a histogram
+// proto with float counts.
+func FloatHistogramToHistogramProto(t int64, h *histogram.FloatHistogram) prompb.Histogram {
+	return prompb.Histogram{
+		Count:          &prompb.Histogram_CountFloat{CountFloat: h.Count},
+		Sum:            h.Sum,
+		Schema:         h.Schema,
+		ZeroThreshold:  h.ZeroThreshold,
+		ZeroCount:      &prompb.Histogram_ZeroCountFloat{ZeroCountFloat: h.ZeroCount},
+		NegativeSpans:  spansToSpansProto(h.NegativeSpans),
+		NegativeCounts: h.NegativeBuckets,
+		PositiveSpans:  spansToSpansProto(h.PositiveSpans),
+		PositiveCounts: h.PositiveBuckets,
+		Timestamp:      t,
+	}
+}
+
+func histogramProtosToSamples(hps []prompb.Histogram) []histogramSample {
+	if len(hps) == 0 {
+		return nil
+	}
+	res := make([]histogramSample, 0, len(hps))
+	for _, hp := range hps {
+		res = append(res, histogramSample{t: hp.Timestamp, h: HistogramProtoToFloatHistogram(hp)})
+	}
+	return res
+}
+
+func spansProtoToSpans(s []prompb.BucketSpan) []histogram.Span {
+	spans := make([]histogram.Span, len(s))
+	for i, span := range s {
+		spans[i] = histogram.Span{Offset: span.Offset, Length: span.Length}
+	}
+	return spans
+}
+
+func spansToSpansProto(s []histogram.Span) []prompb.BucketSpan {
+	spans := make([]prompb.BucketSpan, len(s))
+	for i, span := range s {
+		spans[i] = prompb.BucketSpan{Offset: span.Offset, Length: span.Length}
+	}
+	return spans
+}
+
+// deltasToCounts converts the bucket deltas of an integer histogram to
+// absolute counts.
+func deltasToCounts(deltas []int64) []float64 {
+	counts := make([]float64, len(deltas))
+	var cur int64
+	for i, d := range deltas {
+		cur += d
+		counts[i] = float64(cur)
+	}
+	return counts
+}
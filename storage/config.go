@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	config_util "github.com/prometheus/common/config"
 	"github.com/prometheus/common/model"
 )
@@ -28,6 +29,22 @@ type RemoteReadConfig struct {
 	// RequiredMatchers is an optional list of equality matchers which have to
 	// be present in a selector to query the remote read endpoint.
 	RequiredMatchers model.LabelSet `yaml:"required_matchers,omitempty"`
+
+	// SampleCache optionally caches the raw samples read from the remote
+	// read endpoint. It may be shared by several endpoints.
+	SampleCache *SampleCache `yaml:"-"`
+
+	// MaxRetries is the number of times a failed read is retried.
+	MaxRetries int `yaml:"max_retries,omitempty"`
+	// BreakerThreshold is the number of consecutive failed reads after which
+	// the endpoint is not read for BreakerCooldown.
+	BreakerThreshold int            `yaml:"breaker_threshold,omitempty"`
+	BreakerCooldown  model.Duration `yaml:"breaker_cooldown,omitempty"`
+	// CoalesceReads makes identical concurrent reads share a single request.
+	CoalesceReads bool `yaml:"coalesce_reads,omitempty"`
+
+	// Reg optionally registers the metrics of the endpoint's client.
+	Reg prometheus.Registerer `yaml:"-"`
 }
 
 // UnmarshalYAML implements the yaml.Unmarshaler interface.
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Endpoints collects the remote endpoints that were read from while
+// serving a query, and the size of their responses.
+type Endpoints struct {
+	mtx   sync.Mutex
+	names map[string]struct{}
+	bytes map[string]int64
+}
+
+type endpointsKey struct{}
+
+// WithEndpoints returns a copy of the context that records the remote
+// endpoints read from with it into the returned Endpoints.
+func WithEndpoints(ctx context.Context) (context.Context, *Endpoints) {
+	e := &Endpoints{names: map[string]struct{}{}, bytes: map[string]int64{}}
+	return context.WithValue(ctx, endpointsKey{}, e), e
+}
+
+// recordEndpoint adds the endpoint to the Endpoints of the context, if any.
+func recordEndpoint(ctx context.Context, name string) {
+	e, ok := ctx.Value(endpointsKey{}).(*Endpoints)
+	if !ok {
+		return
+	}
+	e.mtx.Lock()
+	e.names[name] = struct{}{}
+	e.mtx.Unlock()
+}
+
+// recordEndpointBytes adds the size of a response of the endpoint to the
+// Endpoints of the context, if any.
+func recordEndpointBytes(ctx context.Context, name string, n int) {
+	e, ok := ctx.Value(endpointsKey{}).(*Endpoints)
+	if !ok {
+		return
+	}
+	e.mtx.Lock()
+	e.bytes[name] += int64(n)
+	e.mtx.Unlock()
+}
+
+// Bytes returns the size of the compressed responses per endpoint.
+func (e *Endpoints) Bytes() map[string]int64 {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	bytes := make(map[string]int64, len(e.bytes))
+	for n, b := range e.bytes {
+		bytes[n] = b
+	}
+	return bytes
+}
+
+// Names returns the sorted names of the recorded endpoints.
+func (e *Endpoints) Names() []string {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	names := make([]string, 0, len(e.names))
+	for n := range e.names {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/prompb"
+)
+
+// SelectPlan describes how a remote read endpoint or a local queryable would
+// serve a select.
+type SelectPlan struct {
+	// Endpoint names the remote read endpoint or the local queryable.
+	Endpoint string `json:"endpoint"`
+	// Query is the remote read query that would be sent. It is nil for local
+	// queryables.
+	Query *prompb.Query `json:"query,omitempty"`
+	// Skipped is the reason the endpoint would not be contacted, empty if it
+	// would be.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// Explainer is implemented by queryables that can tell how they would serve
+// a select without executing it.
+type Explainer interface {
+	Explain(mint, maxt int64, p *SelectParams, matchers ...*labels.Matcher) ([]SelectPlan, error)
+}
+
+// Explain implements Explainer for the remote read endpoints and the local
+// queryables of the storage.
+func (s *storage) Explain(mint, maxt int64, p *SelectParams, matchers ...*labels.Matcher) ([]SelectPlan, error) {
+	var plans []SelectPlan
+	for _, e := range s.explainers {
+		ps, err := e.Explain(mint, maxt, p, matchers...)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, ps...)
+	}
+	return plans, nil
+}
+
+// endpointExplainer explains the selects of a remote read endpoint.
+type endpointExplainer struct {
+	client   *Client
+	required []*labels.Matcher
+}
+
+func (e *endpointExplainer) Explain(mint, maxt int64, p *SelectParams, matchers ...*labels.Matcher) ([]SelectPlan, error) {
+	plan := SelectPlan{Endpoint: e.client.url.Redacted()}
+	if missing := missingRequiredMatchers(e.required, matchers); len(missing) > 0 {
+		plan.Skipped = fmt.Sprintf("required matchers %v missing", missing)
+		return []SelectPlan{plan}, nil
+	}
+	query, err := ToQuery(mint, maxt, matchers, p)
+	if err != nil {
+		return nil, err
+	}
+	plan.Query = query
+	return []SelectPlan{plan}, nil
+}
+
+// localExplainer explains the selects of a local queryable that cannot
+// explain itself. It is always contacted.
+type localExplainer struct {
+	q Queryable
+}
+
+func (e localExplainer) Explain(mint, maxt int64, p *SelectParams, matchers ...*labels.Matcher) ([]SelectPlan, error) {
+	return []SelectPlan{{Endpoint: fmt.Sprintf("local %T", e.q)}}, nil
+}
+
+// Explain implements Explainer. The head is skipped if the selected range
+// ends before its retention.
+func (h *Head) Explain(mint, maxt int64, p *SelectParams, matchers ...*labels.Matcher) ([]SelectPlan, error) {
+	plan := SelectPlan{Endpoint: "local head"}
+	h.mtx.RLock()
+	hmint := h.mint()
+	h.mtx.RUnlock()
+	if maxt < hmint {
+		plan.Skipped = fmt.Sprintf("range ends before the head's retention starting at %d", hmint)
+	}
+	return []SelectPlan{plan}, nil
+}
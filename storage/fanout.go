@@ -5,6 +5,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/lwangrabbit/promql-sdk/pkg/histogram"
 	"github.com/lwangrabbit/promql-sdk/pkg/labels"
 )
 
@@ -279,6 +280,15 @@ func (c *mergeIterator) At() (t int64, v float64) {
 	return c.h[0].At()
 }
 
+func (c *mergeIterator) AtHistogram() (t int64, h *histogram.FloatHistogram) {
+	if len(c.h) == 0 {
+		panic("mergeIterator.AtHistogram() called after .Next() returned false.")
+	}
+
+	t, _ = c.h[0].At()
+	return t, HistogramAt(c.h[0])
+}
+
 func (c *mergeIterator) Next() bool {
 	if c.h == nil {
 		for _, iter := range c.iterators {
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/prompb"
+)
+
+// maxFutureSkew is how far in milliseconds samples may be ahead of the wall
+// clock to be accepted by a Head.
+const maxFutureSkew = int64(10 * time.Minute / time.Millisecond)
+
+// Head is a bounded in-memory store for recently written samples. It keeps
+// at most maxSeries series and drops samples that are older than the
+// retention relative to the newest sample it has seen, bounded by the wall
+// clock.
+type Head struct {
+	mtx       sync.RWMutex
+	series    map[uint64]*memSeries
+	retention int64 // Retention in milliseconds.
+	maxSeries int
+	maxt      int64
+	truncated int64 // The mint the series were last truncated to.
+	now       func() int64
+}
+
+// memSeries holds the samples of a single series in timestamp order.
+type memSeries struct {
+	lset    labels.Labels
+	samples []prompb.Sample
+}
+
+// NewHead returns a new Head retaining samples for the given duration.
+// A maxSeries of zero or less disables the series limit.
+func NewHead(retention time.Duration, maxSeries int) *Head {
+	return &Head{
+		series:    map[uint64]*memSeries{},
+		retention: durationMilliseconds(retention),
+		maxSeries: maxSeries,
+		maxt:      math.MinInt64,
+		truncated: math.MinInt64,
+		now: func() int64 {
+			return time.Now().UnixNano() / int64(time.Millisecond)
+		},
+	}
+}
+
+func durationMilliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
+
+// mint returns the lowest timestamp that is still within the retention.
+// The caller must hold the lock.
+func (h *Head) mint() int64 {
+	if h.maxt == math.MinInt64 {
+		return math.MinInt64
+	}
+	maxt := h.maxt
+	if now := h.now(); now < maxt {
+		maxt = now
+	}
+	return maxt - h.retention
+}
+
+// Appender implements storage.Appendable.
+func (h *Head) Appender() (Appender, error) {
+	return &headAppender{head: h}, nil
+}
+
+// Querier implements storage.Queryable.
+func (h *Head) Querier(ctx context.Context, mint, maxt int64) (Querier, error) {
+	return &headQuerier{head: h, mint: mint, maxt: maxt}, nil
+}
+
+// truncateDue reports whether the retention moved on by a tenth since the
+// last truncation. Truncating walks all series, so it is not done on every
+// commit. The caller must hold the lock.
+func (h *Head) truncateDue() bool {
+	mint := h.mint()
+	if mint == math.MinInt64 {
+		return false
+	}
+	return h.truncated == math.MinInt64 || mint-h.truncated >= h.retention/10
+}
+
+// truncate drops all samples that fell out of the retention and removes
+// series without any remaining samples. The caller must hold the lock.
+func (h *Head) truncate() {
+	mint := h.mint()
+	h.truncated = mint
+	for ref, s := range h.series {
+		i := sort.Search(len(s.samples), func(n int) bool {
+			return s.samples[n].Timestamp >= mint
+		})
+		if i == len(s.samples) {
+			delete(h.series, ref)
+			continue
+		}
+		if i > 0 {
+			s.samples = append(s.samples[:0], s.samples[i:]...)
+		}
+	}
+}
+
+// headAppender collects samples and adds them to the Head on Commit.
+type headAppender struct {
+	head    *Head
+	pending []headSample
+}
+
+type headSample struct {
+	ref  uint64
+	lset labels.Labels
+	t    int64
+	v    float64
+}
+
+// Add implements storage.Appender.
+func (a *headAppender) Add(l labels.Labels, t int64, v float64) (uint64, error) {
+	ref := l.Hash()
+	a.pending = append(a.pending, headSample{ref: ref, lset: l, t: t, v: v})
+	return ref, nil
+}
+
+// AddFast implements storage.Appender.
+func (a *headAppender) AddFast(l labels.Labels, ref uint64, t int64, v float64) error {
+	a.pending = append(a.pending, headSample{ref: ref, lset: l, t: t, v: v})
+	return nil
+}
+
+// Commit implements storage.Appender. Samples that are out of order, older
+// than the retention, too far in the future or would exceed the series limit
+// are skipped and the last such error is returned after all other samples
+// have been added.
+func (a *headAppender) Commit() error {
+	h := a.head
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	var (
+		lastErr error
+		maxt    = h.now() + maxFutureSkew
+	)
+	for _, p := range a.pending {
+		if p.t < h.mint() || p.t > maxt {
+			lastErr = ErrOutOfBounds
+			continue
+		}
+		s, ok := h.series[p.ref]
+		if !ok {
+			if h.maxSeries > 0 && len(h.series) >= h.maxSeries {
+				lastErr = ErrTooManySeries
+				continue
+			}
+			s = &memSeries{lset: p.lset}
+			h.series[p.ref] = s
+		}
+		if n := len(s.samples); n > 0 {
+			last := s.samples[n-1]
+			if p.t < last.Timestamp {
+				lastErr = ErrOutOfOrderSample
+				continue
+			}
+			if p.t == last.Timestamp {
+				if p.v != last.Value {
+					lastErr = ErrDuplicateSampleForTimestamp
+				}
+				continue
+			}
+		}
+		s.samples = append(s.samples, prompb.Sample{Timestamp: p.t, Value: p.v})
+		if p.t > h.maxt {
+			h.maxt = p.t
+		}
+	}
+	if h.truncateDue() {
+		h.truncate()
+	}
+	a.pending = a.pending[:0]
+	return lastErr
+}
+
+// Rollback implements storage.Appender.
+func (a *headAppender) Rollback() error {
+	a.pending = a.pending[:0]
+	return nil
+}
+
+// headQuerier implements storage.Querier over the samples of a Head.
+type headQuerier struct {
+	head       *Head
+	mint, maxt int64
+}
+
+// Select implements storage.Querier. The returned series hold a copy of the
+// samples within the querier's time range and the retention.
+func (q *headQuerier) Select(p *SelectParams, matchers ...*labels.Matcher) (SeriesSet, error) {
+	q.head.mtx.RLock()
+	defer q.head.mtx.RUnlock()
+
+	// Samples out of the retention are only dropped on truncation.
+	mint := q.mint
+	if m := q.head.mint(); m > mint {
+		mint = m
+	}
+	series := make([]Series, 0)
+	for _, s := range q.head.series {
+		if !matchLabels(s.lset, matchers) {
+			continue
+		}
+		start := sort.Search(len(s.samples), func(n int) bool {
+			return s.samples[n].Timestamp >= mint
+		})
+		end := sort.Search(len(s.samples), func(n int) bool {
+			return s.samples[n].Timestamp > q.maxt
+		})
+		if start >= end {
+			continue
+		}
+		samples := make([]prompb.Sample, end-start)
+		copy(samples, s.samples[start:end])
+		series = append(series, &concreteSeries{
+			labels:  s.lset,
+			samples: samples,
+		})
+	}
+	sort.Sort(byLabel(series))
+	return &concreteSeriesSet{series: series}, nil
+}
+
+// LabelValues implements storage.Querier.
+func (q *headQuerier) LabelValues(name string) ([]string, error) {
+	q.head.mtx.RLock()
+	defer q.head.mtx.RUnlock()
+
+	set := map[string]struct{}{}
+	for _, s := range q.head.series {
+		if v := s.lset.Get(name); v != "" {
+			set[v] = struct{}{}
+		}
+	}
+	values := make([]string, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
+// Close implements storage.Querier and is a noop.
+func (q *headQuerier) Close() error {
+	return nil
+}
+
+// matchLabels returns whether the label set satisfies all matchers.
+func matchLabels(lset labels.Labels, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(lset.Get(m.Name)) {
+			return false
+		}
+	}
+	return true
+}
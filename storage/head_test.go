@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+)
+
+func TestHead(t *testing.T) {
+	h := NewHead(time.Minute, 2)
+
+	app, err := h.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := labels.FromStrings(labels.MetricName, "up", "job", "a")
+	b := labels.FromStrings(labels.MetricName, "up", "job", "b")
+	c := labels.FromStrings(labels.MetricName, "up", "job", "c")
+	for ts := int64(0); ts <= 120000; ts += 15000 {
+		app.Add(a, ts, 1)
+		app.Add(b, ts, 2)
+	}
+	app.Add(c, 120000, 3)
+	if err := app.Commit(); err != ErrTooManySeries {
+		t.Fatalf("expected %v, got %v", ErrTooManySeries, err)
+	}
+
+	app.Add(a, 105000, 1)
+	if err := app.Commit(); err != ErrOutOfOrderSample {
+		t.Fatalf("expected %v, got %v", ErrOutOfOrderSample, err)
+	}
+
+	q, err := h.Querier(context.Background(), 0, 120000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := labels.NewMatcher(labels.MatchEqual, "job", "a")
+	set, err := q.Select(nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !set.Next() {
+		t.Fatal("expected a series")
+	}
+	if !labels.Equal(set.At().Labels(), a) {
+		t.Fatalf("expected %s, got %s", a, set.At().Labels())
+	}
+	it := set.At().Iterator()
+	var n int
+	for it.Next() {
+		ts, _ := it.At()
+		if ts < 60000 {
+			t.Fatalf("sample at %d is outside of the retention", ts)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Fatalf("expected 5 samples, got %d", n)
+	}
+	if set.Next() {
+		t.Fatal("expected a single series")
+	}
+}
+
+func TestHeadFutureSamples(t *testing.T) {
+	h := NewHead(time.Minute, 0)
+	h.now = func() int64 { return 120000 }
+
+	app, err := h.Appender()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := labels.FromStrings(labels.MetricName, "up", "job", "a")
+	b := labels.FromStrings(labels.MetricName, "up", "job", "b")
+	app.Add(a, 90000, 1)
+	app.Add(b, 120000+maxFutureSkew, 2)
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	app.Add(b, 120000+maxFutureSkew+1, 2)
+	if err := app.Commit(); err != ErrOutOfBounds {
+		t.Fatalf("expected %v, got %v", ErrOutOfBounds, err)
+	}
+
+	// The retention is bounded by the wall clock rather than by the
+	// newest sample, so the sample of a is kept.
+	q, err := h.Querier(context.Background(), 0, 120000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := labels.NewMatcher(labels.MatchEqual, "job", "a")
+	set, err := q.Select(nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !set.Next() {
+		t.Fatal("expected the series of a")
+	}
+
+	// Samples out of the retention are not returned before truncation.
+	h.now = func() int64 { return 151000 }
+	set, err = q.Select(nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Next() {
+		t.Fatalf("unexpected series %s", set.At().Labels())
+	}
+}
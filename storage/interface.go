@@ -17,6 +17,7 @@ import (
 	"context"
 	"errors"
 
+	"github.com/lwangrabbit/promql-sdk/pkg/histogram"
 	"github.com/lwangrabbit/promql-sdk/pkg/labels"
 )
 
@@ -26,6 +27,7 @@ var (
 	ErrOutOfOrderSample            = errors.New("out of order sample")
 	ErrDuplicateSampleForTimestamp = errors.New("duplicate sample for timestamp")
 	ErrOutOfBounds                 = errors.New("out of bounds")
+	ErrTooManySeries               = errors.New("too many series")
 )
 
 // storage ingests and manages samples, along with various indexes. All methods
@@ -79,6 +81,12 @@ func (f QueryableFunc) Querier(ctx context.Context, mint, maxt int64) (Querier,
 	return f(ctx, mint, maxt)
 }
 
+// Appendable allows creating appenders.
+type Appendable interface {
+	// Appender returns a new appender against the storage.
+	Appender() (Appender, error)
+}
+
 // Appender provides batched appends against a storage.
 type Appender interface {
 	Add(l labels.Labels, t int64, v float64) (uint64, error)
@@ -119,3 +127,21 @@ type SeriesIterator interface {
 	// Err returns the current error.
 	Err() error
 }
+
+// HistogramIterator is implemented by series iterators that can return
+// native histogram samples.
+type HistogramIterator interface {
+	// AtHistogram returns the current timestamp and histogram. The
+	// histogram is nil if the current sample is a float.
+	AtHistogram() (t int64, h *histogram.FloatHistogram)
+}
+
+// HistogramAt returns the histogram at the current position of the iterator,
+// or nil if the current sample is a float.
+func HistogramAt(it SeriesIterator) *histogram.FloatHistogram {
+	if hit, ok := it.(HistogramIterator); ok {
+		_, h := hit.AtHistogram()
+		return h
+	}
+	return nil
+}
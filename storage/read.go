@@ -76,7 +76,16 @@ type requiredMatchersQuerier struct {
 // Select returns a NoopSeriesSet if the given matchers don't match the label
 // set of the requiredMatchersQuerier. Otherwise it'll call the wrapped querier.
 func (q requiredMatchersQuerier) Select(p *SelectParams, matchers ...*labels.Matcher) (SeriesSet, error) {
-	ms := q.requiredMatchers
+	if len(missingRequiredMatchers(q.requiredMatchers, matchers)) > 0 {
+		return NoopSeriesSet(), nil
+	}
+	return q.Querier.Select(p, matchers...)
+}
+
+// missingRequiredMatchers returns the required matchers that are not among
+// the given matchers.
+func missingRequiredMatchers(required, matchers []*labels.Matcher) []*labels.Matcher {
+	ms := append([]*labels.Matcher(nil), required...)
 	for _, m := range matchers {
 		for i, r := range ms {
 			if m.Type == labels.MatchEqual && m.Name == r.Name && m.Value == r.Value {
@@ -88,8 +97,5 @@ func (q requiredMatchersQuerier) Select(p *SelectParams, matchers ...*labels.Mat
 			break
 		}
 	}
-	if len(ms) > 0 {
-		return NoopSeriesSet(), nil
-	}
-	return q.Querier.Select(p, matchers...)
+	return ms
 }
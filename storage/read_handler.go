@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/chunkenc"
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/prompb"
+)
+
+const (
+	// maxSamplesPerChunk is the number of samples encoded into a single XOR
+	// chunk of a streamed response, matching the Prometheus TSDB.
+	maxSamplesPerChunk = 120
+	// maxBytesInFrame is the soft limit for the size of a single frame of a
+	// streamed response.
+	maxBytesInFrame = 1024 * 1024
+)
+
+// errStreamedHistogram is returned when a streamed series contains native
+// histograms, which can not be encoded into XOR chunks.
+var errStreamedHistogram = errors.New("native histograms can not be streamed as XOR chunks")
+
+type readHandler struct {
+	queryable      Queryable
+	externalLabels labels.Labels
+}
+
+// NewReadHandler creates a http.Handler that serves remote read requests
+// from the provided queryable. Matchers on the external labels are dropped
+// before querying and the external labels are added to all returned series,
+// the labels of a series taking precedence.
+func NewReadHandler(queryable Queryable, externalLabels labels.Labels) http.Handler {
+	return &readHandler{
+		queryable:      queryable,
+		externalLabels: externalLabels,
+	}
+}
+
+func (h *readHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeReadRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	responseType, err := negotiateResponseType(req.AcceptedResponseTypes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch responseType {
+	case prompb.ReadRequest_STREAMED_XOR_CHUNKS:
+		h.serveChunked(r.Context(), w, req)
+	default:
+		h.serveSamples(r.Context(), w, req)
+	}
+}
+
+func (h *readHandler) serveSamples(ctx context.Context, w http.ResponseWriter, req *prompb.ReadRequest) {
+	resp := prompb.ReadResponse{
+		Results: make([]*prompb.QueryResult, len(req.Queries)),
+	}
+	for i, query := range req.Queries {
+		err := h.selectQuery(ctx, query, func(set SeriesSet) error {
+			res, err := ToQueryResult(set)
+			if err != nil {
+				return err
+			}
+			resp.Results[i] = res
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := EncodeReadResponse(&resp, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *readHandler) serveChunked(ctx context.Context, w http.ResponseWriter, req *prompb.ReadRequest) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "internal http.ResponseWriter does not implement http.Flusher interface", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+
+	tw := &writeTracker{Writer: w}
+	cw := NewChunkedWriter(tw, f)
+	for i, query := range req.Queries {
+		err := h.selectQuery(ctx, query, func(set SeriesSet) error {
+			return streamChunkedReadResponses(cw, int64(i), set)
+		})
+		switch {
+		case err == nil:
+			continue
+		case err == errStreamedHistogram && !tw.written:
+			// Native histograms can not be encoded into XOR chunks. As
+			// nothing was sent yet, fall back to a sampled response, which
+			// clients tell by its content type.
+			h.serveSamples(ctx, w, req)
+		case !tw.written:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			// Once the first frame has been flushed the status code can no
+			// longer be changed and an error message would corrupt the
+			// stream; the client will see a truncated stream.
+			log.Printf("remote read: streaming the response failed: %v", err)
+		}
+		return
+	}
+}
+
+// writeTracker records whether anything was written to the wrapped writer.
+type writeTracker struct {
+	io.Writer
+	written bool
+}
+
+func (w *writeTracker) Write(b []byte) (int, error) {
+	w.written = true
+	return w.Writer.Write(b)
+}
+
+// selectQuery runs a single query against the queryable and passes the
+// resulting series, with the external labels added, to fn.
+func (h *readHandler) selectQuery(ctx context.Context, query *prompb.Query, fn func(SeriesSet) error) error {
+	mint, maxt, matchers, params, err := FromQuery(query)
+	if err != nil {
+		return err
+	}
+
+	querier, err := h.queryable.Querier(ctx, mint, maxt)
+	if err != nil {
+		return err
+	}
+	defer querier.Close()
+
+	set, err := querier.Select(params, filterExternalLabelMatchers(matchers, h.externalLabels)...)
+	if err != nil {
+		return err
+	}
+	return fn(&externalLabelsSeriesSet{SeriesSet: set, externalLabels: h.externalLabels})
+}
+
+// negotiateResponseType picks the first response type in the accepted list
+// that is supported. An empty list defaults to sampled responses.
+func negotiateResponseType(accepted []prompb.ReadRequest_ResponseType) (prompb.ReadRequest_ResponseType, error) {
+	if len(accepted) == 0 {
+		return prompb.ReadRequest_SAMPLES, nil
+	}
+	for _, t := range accepted {
+		switch t {
+		case prompb.ReadRequest_SAMPLES, prompb.ReadRequest_STREAMED_XOR_CHUNKS:
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("server does not support any of the requested response types: %v", accepted)
+}
+
+// streamChunkedReadResponses iterates over series, encodes their samples
+// into XOR chunks and writes them as ChunkedReadResponse frames. A frame is
+// flushed whenever it grows over maxBytesInFrame or a series is completed.
+// errStreamedHistogram is returned for the first native histogram sample.
+func streamChunkedReadResponses(w *ChunkedWriter, queryIndex int64, set SeriesSet) error {
+	var chks []prompb.Chunk
+	for set.Next() {
+		series := set.At()
+		lbls := labelsToLabelsProto(series.Labels())
+		lblsSize := 0
+		for _, l := range lbls {
+			lblsSize += l.Size()
+		}
+		frameBytes := lblsSize
+
+		it := series.Iterator()
+		chks = chks[:0]
+		var (
+			chk *chunkenc.XORChunk
+			app *chunkenc.XORAppender
+			cur prompb.Chunk
+		)
+		flushChunk := func() {
+			cur.Data = chk.Bytes()
+			cur.Type = prompb.Chunk_XOR
+			chks = append(chks, cur)
+			frameBytes += cur.Size()
+			chk = nil
+		}
+		writeFrame := func() error {
+			b, err := (&prompb.ChunkedReadResponse{
+				ChunkedSeries: []*prompb.ChunkedSeries{
+					{Labels: lbls, Chunks: chks},
+				},
+				QueryIndex: queryIndex,
+			}).Marshal()
+			if err != nil {
+				return err
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			chks = chks[:0]
+			frameBytes = lblsSize
+			return nil
+		}
+
+		for it.Next() {
+			if HistogramAt(it) != nil {
+				return errStreamedHistogram
+			}
+			t, v := it.At()
+			if chk == nil {
+				chk = chunkenc.NewXORChunk()
+				app = chk.Appender()
+				cur = prompb.Chunk{MinTimeMs: t}
+			}
+			app.Append(t, v)
+			cur.MaxTimeMs = t
+
+			if chk.NumSamples() < maxSamplesPerChunk {
+				continue
+			}
+			flushChunk()
+			if frameBytes >= maxBytesInFrame {
+				if err := writeFrame(); err != nil {
+					return err
+				}
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		if chk != nil {
+			flushChunk()
+		}
+		if len(chks) > 0 {
+			if err := writeFrame(); err != nil {
+				return err
+			}
+		}
+	}
+	return set.Err()
+}
+
+// filterExternalLabelMatchers drops the equality matchers that are satisfied
+// by the external labels, as the underlying storage does not know about them.
+func filterExternalLabelMatchers(ms []*labels.Matcher, externalLabels labels.Labels) []*labels.Matcher {
+	if len(externalLabels) == 0 {
+		return ms
+	}
+	filtered := make([]*labels.Matcher, 0, len(ms))
+	for _, m := range ms {
+		if m.Type == labels.MatchEqual && externalLabels.Get(m.Name) == m.Value && m.Value != "" {
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+	return filtered
+}
+
+// externalLabelsSeriesSet adds the external labels to all series of the
+// wrapped set that do not already have a label of the same name.
+type externalLabelsSeriesSet struct {
+	SeriesSet
+	externalLabels labels.Labels
+}
+
+func (s *externalLabelsSeriesSet) At() Series {
+	series := s.SeriesSet.At()
+	if len(s.externalLabels) == 0 {
+		return series
+	}
+	return &externalLabelsSeries{Series: series, labels: addExternalLabels(series.Labels(), s.externalLabels)}
+}
+
+type externalLabelsSeries struct {
+	Series
+	labels labels.Labels
+}
+
+func (s *externalLabelsSeries) Labels() labels.Labels {
+	return s.labels
+}
+
+func addExternalLabels(lset, externalLabels labels.Labels) labels.Labels {
+	result := make(labels.Labels, 0, len(lset)+len(externalLabels))
+	result = append(result, lset...)
+	for _, l := range externalLabels {
+		if lset.Get(l.Name) == "" {
+			result = append(result, l)
+		}
+	}
+	sort.Sort(result)
+	return result
+}
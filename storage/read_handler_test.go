@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/chunkenc"
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/prompb"
+)
+
+func TestReadHandlerStreamedChunks(t *testing.T) {
+	h := NewHead(2*time.Hour, 0)
+	app, _ := h.Appender()
+	lset := labels.FromStrings(labels.MetricName, "up", "job", "a")
+	for ts := int64(0); ts < 300*15000; ts += 15000 {
+		app.Add(lset, ts, float64(ts))
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &prompb.ReadRequest{
+		Queries: []*prompb.Query{{
+			StartTimestampMs: 0,
+			EndTimestampMs:   300 * 15000,
+			Matchers: []*prompb.LabelMatcher{
+				{Type: prompb.LabelMatcher_EQ, Name: "job", Value: "a"},
+				{Type: prompb.LabelMatcher_EQ, Name: "cluster", Value: "c1"},
+			},
+		}},
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	handler := NewReadHandler(h, labels.FromStrings("cluster", "c1"))
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/read", bytes.NewReader(snappy.Encode(nil, data))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	expected := labelsToLabelsProto(labels.FromStrings(labels.MetricName, "up", "cluster", "c1", "job", "a"))
+	r := NewChunkedReader(rec.Body, maxBytesInFrame*2, nil)
+	var samples int
+	for {
+		var resp prompb.ChunkedReadResponse
+		err := r.NextProto(&resp)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range resp.ChunkedSeries {
+			if !proto.Equal(&prompb.ChunkedSeries{Labels: s.Labels}, &prompb.ChunkedSeries{Labels: expected}) {
+				t.Fatalf("unexpected labels %v", s.Labels)
+			}
+			for _, c := range s.Chunks {
+				it := chunkenc.FromData(c.Data).Iterator()
+				for it.Next() {
+					ts, v := it.At()
+					if ts != int64(samples)*15000 || v != float64(ts) {
+						t.Fatalf("unexpected sample %d: %d %f", samples, ts, v)
+					}
+					samples++
+				}
+			}
+		}
+	}
+	if samples != 300 {
+		t.Fatalf("expected 300 samples, got %d", samples)
+	}
+}
+
+func TestReadHandlerBodyLimit(t *testing.T) {
+	body := bytes.NewReader(make([]byte, decodeReadLimit+1))
+	rec := httptest.NewRecorder()
+	NewReadHandler(NewHead(time.Hour, 0), nil).ServeHTTP(rec, httptest.NewRequest("POST", "/read", body))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "exceeds") {
+		t.Fatalf("unexpected error %q", rec.Body.String())
+	}
+}
+
+func TestReadHandlerStreamedHistograms(t *testing.T) {
+	ts := &prompb.TimeSeries{
+		Labels:  labelsToLabelsProto(labels.FromStrings(labels.MetricName, "h")),
+		Samples: []prompb.Sample{{Timestamp: 0, Value: 1}},
+		Histograms: []prompb.Histogram{{
+			Count:     &prompb.Histogram_CountFloat{CountFloat: 3},
+			Sum:       7,
+			ZeroCount: &prompb.Histogram_ZeroCountFloat{},
+			Timestamp: 15000,
+		}},
+	}
+	queryable := QueryableFunc(func(ctx context.Context, mint, maxt int64) (Querier, error) {
+		return staticQuerier{res: &prompb.QueryResult{Timeseries: []*prompb.TimeSeries{ts}}}, nil
+	})
+
+	req := &prompb.ReadRequest{
+		Queries: []*prompb.Query{{
+			StartTimestampMs: 0,
+			EndTimestampMs:   15000,
+			Matchers: []*prompb.LabelMatcher{
+				{Type: prompb.LabelMatcher_EQ, Name: labels.MetricName, Value: "h"},
+			},
+		}},
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS, prompb.ReadRequest_SAMPLES},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	NewReadHandler(queryable, nil).ServeHTTP(rec, httptest.NewRequest("POST", "/read", bytes.NewReader(snappy.Encode(nil, data))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The histograms can not be streamed as XOR chunks.
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-protobuf" {
+		t.Fatalf("expected a sampled response, got content type %q", ct)
+	}
+	b, err := snappy.Decode(nil, rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp prompb.ReadResponse
+	if err := proto.Unmarshal(b, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Results) != 1 || len(resp.Results[0].Timeseries) != 1 {
+		t.Fatalf("unexpected response %v", resp)
+	}
+	got := resp.Results[0].Timeseries[0]
+	if len(got.Samples) != 1 || len(got.Histograms) != 1 || got.Histograms[0].Sum != 7 || got.Histograms[0].GetCountFloat() != 3 {
+		t.Fatalf("unexpected series %v", got)
+	}
+}
+
+func TestReadHandlerStreamedHistogramsAfterFirstFrame(t *testing.T) {
+	floats := &prompb.TimeSeries{
+		Labels:  labelsToLabelsProto(labels.FromStrings(labels.MetricName, "f")),
+		Samples: []prompb.Sample{{Timestamp: 0, Value: 1}},
+	}
+	hists := &prompb.TimeSeries{
+		Labels: labelsToLabelsProto(labels.FromStrings(labels.MetricName, "h")),
+		Histograms: []prompb.Histogram{{
+			Count:     &prompb.Histogram_CountFloat{CountFloat: 3},
+			ZeroCount: &prompb.Histogram_ZeroCountFloat{},
+			Timestamp: 15000,
+		}},
+	}
+	// The first query reads the floats, the second one the histograms.
+	queryable := QueryableFunc(func(ctx context.Context, mint, maxt int64) (Querier, error) {
+		ts := floats
+		if mint > 0 {
+			ts = hists
+		}
+		return staticQuerier{res: &prompb.QueryResult{Timeseries: []*prompb.TimeSeries{ts}}}, nil
+	})
+
+	req := &prompb.ReadRequest{
+		Queries: []*prompb.Query{
+			{StartTimestampMs: 0, EndTimestampMs: 0},
+			{StartTimestampMs: 15000, EndTimestampMs: 15000},
+		},
+		AcceptedResponseTypes: []prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS, prompb.ReadRequest_SAMPLES},
+	}
+	for _, q := range req.Queries {
+		q.Matchers = []*prompb.LabelMatcher{{Type: prompb.LabelMatcher_RE, Name: labels.MetricName, Value: ".+"}}
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	NewReadHandler(queryable, nil).ServeHTTP(rec, httptest.NewRequest("POST", "/read", bytes.NewReader(snappy.Encode(nil, data))))
+
+	// The stream already started, so it is truncated rather than followed
+	// by an error message.
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse" {
+		t.Fatalf("expected a streamed response, got content type %q", ct)
+	}
+	r := NewChunkedReader(rec.Body, maxBytesInFrame, nil)
+	var frames int
+	for {
+		var resp prompb.ChunkedReadResponse
+		err := r.NextProto(&resp)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.QueryIndex != 0 {
+			t.Fatalf("unexpected frame of query %d", resp.QueryIndex)
+		}
+		frames++
+	}
+	if frames != 1 {
+		t.Fatalf("expected 1 frame, got %d", frames)
+	}
+}
+
+// staticQuerier returns the series of a fixed query result.
+type staticQuerier struct {
+	res *prompb.QueryResult
+}
+
+func (q staticQuerier) Select(*SelectParams, ...*labels.Matcher) (SeriesSet, error) {
+	return FromQueryResult(q.res), nil
+}
+
+func (staticQuerier) LabelValues(string) ([]string, error) {
+	return nil, nil
+}
+
+func (staticQuerier) Close() error {
+	return nil
+}
@@ -0,0 +1,375 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/chunkenc"
+	"github.com/lwangrabbit/promql-sdk/pkg/histogram"
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/prompb"
+)
+
+const (
+	// DefaultSampleCacheBlockSize is the default time range of a cached block.
+	DefaultSampleCacheBlockSize = 2 * time.Hour
+
+	// sampleCacheGracePeriod is how long a block must have ended before it is
+	// cached, giving late samples time to arrive at the remote endpoint.
+	sampleCacheGracePeriod = 5 * time.Minute
+)
+
+// SampleCache is a memory-bounded LRU cache of raw samples read from remote
+// endpoints. Samples are stored per matcher set in fixed time blocks and are
+// XOR compressed in chunks of maxSamplesPerChunk samples, native histograms
+// are kept as they are. A SampleCache may be shared by several endpoints.
+type SampleCache struct {
+	blockSize int64 // Block size in milliseconds.
+	maxBytes  int64
+
+	mtx    sync.Mutex
+	size   int64
+	ll     *list.List
+	blocks map[string]*list.Element
+
+	now func() time.Time
+}
+
+// cachedBlock holds the series of a single block for a matcher set.
+type cachedBlock struct {
+	key    string
+	series []cachedSeries
+	size   int64
+}
+
+type cachedSeries struct {
+	lset       labels.Labels
+	chunks     []*chunkenc.XORChunk
+	histograms []histogramSample
+}
+
+// NewSampleCache returns a SampleCache of blocks of the given size that
+// holds at most maxBytes of encoded samples and labels.
+func NewSampleCache(blockSize time.Duration, maxBytes int64) *SampleCache {
+	if blockSize <= 0 {
+		blockSize = DefaultSampleCacheBlockSize
+	}
+	return &SampleCache{
+		blockSize: durationMilliseconds(blockSize),
+		maxBytes:  maxBytes,
+		ll:        list.New(),
+		blocks:    map[string]*list.Element{},
+		now:       time.Now,
+	}
+}
+
+func (c *SampleCache) get(key string) (*cachedBlock, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	e, ok := c.blocks[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*cachedBlock), true
+}
+
+func (c *SampleCache) add(b *cachedBlock) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if b.size > c.maxBytes {
+		return
+	}
+	if e, ok := c.blocks[b.key]; ok {
+		c.size -= e.Value.(*cachedBlock).size
+		c.ll.Remove(e)
+	}
+	c.blocks[b.key] = c.ll.PushFront(b)
+	c.size += b.size
+	for c.size > c.maxBytes {
+		e := c.ll.Back()
+		old := e.Value.(*cachedBlock)
+		c.ll.Remove(e)
+		delete(c.blocks, old.key)
+		c.size -= old.size
+	}
+}
+
+// CachingQueryable returns a storage.Queryable that serves selects from the
+// cache and only reads the blocks that are not cached yet from next. The id
+// must uniquely identify next among the queryables sharing the cache.
+func CachingQueryable(next Queryable, cache *SampleCache, id string) Queryable {
+	return QueryableFunc(func(ctx context.Context, mint, maxt int64) (Querier, error) {
+		return &cachingQuerier{
+			ctx:   ctx,
+			mint:  mint,
+			maxt:  maxt,
+			next:  next,
+			cache: cache,
+			id:    id,
+		}, nil
+	})
+}
+
+// cachingQuerier implements storage.Querier on top of a SampleCache.
+type cachingQuerier struct {
+	ctx        context.Context
+	mint, maxt int64
+	next       Queryable
+	cache      *SampleCache
+	id         string
+}
+
+// Select implements storage.Querier. Blocks that ended at least the grace
+// period ago are served from or added to the cache, the remaining range is
+// read from the underlying queryable.
+func (q *cachingQuerier) Select(p *SelectParams, matchers ...*labels.Matcher) (SeriesSet, error) {
+	bs := q.cache.blockSize
+	first, last := floorDiv(q.mint, bs), floorDiv(q.maxt, bs)
+
+	// Blocks after the last complete one are never cached.
+	complete := floorDiv(q.cache.now().Add(-sampleCacheGracePeriod).UnixNano()/int64(time.Millisecond), bs) - 1
+	if complete > last {
+		complete = last
+	}
+	if complete < first {
+		return q.selectNext(q.mint, q.maxt, p, matchers)
+	}
+
+	prefix := q.id + "\xff" + matchersKey(matchers) + "\xff"
+	blocks := make([]*cachedBlock, complete-first+1)
+	for b := first; b <= complete; b++ {
+		if cb, ok := q.cache.get(prefix + strconv.FormatInt(b, 10)); ok {
+			blocks[b-first] = cb
+		}
+	}
+
+	// Read consecutive runs of missing blocks with a single select each.
+	for b := first; b <= complete; b++ {
+		if blocks[b-first] != nil {
+			continue
+		}
+		end := b
+		for end < complete && blocks[end+1-first] == nil {
+			end++
+		}
+		fetched, err := q.fetchBlocks(prefix, b, end, p, matchers)
+		if err != nil {
+			return nil, err
+		}
+		copy(blocks[b-first:], fetched)
+		b = end
+	}
+
+	var (
+		series = map[uint64]*concreteSeries{}
+		order  []*concreteSeries
+	)
+	appendSeries := func(lset labels.Labels) *concreteSeries {
+		h := lset.Hash()
+		s, ok := series[h]
+		if !ok {
+			s = &concreteSeries{labels: lset}
+			series[h] = s
+			order = append(order, s)
+		}
+		return s
+	}
+	for _, cb := range blocks {
+		for _, cs := range cb.series {
+			s := appendSeries(cs.lset)
+			for _, chk := range cs.chunks {
+				it := chk.Iterator()
+				for it.Next() {
+					t, v := it.At()
+					if t < q.mint || t > q.maxt {
+						continue
+					}
+					s.samples = append(s.samples, prompb.Sample{Timestamp: t, Value: v})
+				}
+				if err := it.Err(); err != nil {
+					return nil, err
+				}
+			}
+			for _, hs := range cs.histograms {
+				if hs.t >= q.mint && hs.t <= q.maxt {
+					s.histograms = append(s.histograms, hs)
+				}
+			}
+		}
+	}
+
+	if complete < last {
+		set, err := q.selectNext((complete+1)*bs, q.maxt, p, matchers)
+		if err != nil {
+			return nil, err
+		}
+		for set.Next() {
+			s := appendSeries(set.At().Labels())
+			it := set.At().Iterator()
+			for it.Next() {
+				t, v := it.At()
+				if h := HistogramAt(it); h != nil {
+					s.histograms = append(s.histograms, histogramSample{t: t, h: h})
+					continue
+				}
+				s.samples = append(s.samples, prompb.Sample{Timestamp: t, Value: v})
+			}
+			if err := it.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if err := set.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]Series, 0, len(order))
+	for _, s := range order {
+		if len(s.samples) > 0 || len(s.histograms) > 0 {
+			result = append(result, s)
+		}
+	}
+	sort.Sort(byLabel(result))
+	return &concreteSeriesSet{series: result}, nil
+}
+
+// fetchBlocks reads the blocks first to last from the underlying queryable,
+// encodes them and adds them to the cache.
+func (q *cachingQuerier) fetchBlocks(prefix string, first, last int64, p *SelectParams, matchers []*labels.Matcher) ([]*cachedBlock, error) {
+	// The blocks are shared by all selects with the same matchers, so the
+	// hints of this select, which may allow the endpoint to return fewer
+	// samples, are not passed on.
+	if p != nil {
+		p = &SelectParams{}
+	}
+	bs := q.cache.blockSize
+	set, err := q.selectNext(first*bs, (last+1)*bs-1, p, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([]*cachedBlock, last-first+1)
+	for i := range blocks {
+		blocks[i] = &cachedBlock{key: prefix + strconv.FormatInt(first+int64(i), 10)}
+	}
+	for set.Next() {
+		lset := set.At().Labels()
+		var (
+			added = make([]bool, len(blocks))
+			apps  = make([]*chunkenc.XORAppender, len(blocks))
+		)
+		it := set.At().Iterator()
+		for it.Next() {
+			t, v := it.At()
+			i := floorDiv(t, bs) - first
+			if i < 0 || i >= int64(len(blocks)) {
+				continue
+			}
+			if !added[i] {
+				blocks[i].series = append(blocks[i].series, cachedSeries{lset: lset})
+				added[i] = true
+			}
+			cs := &blocks[i].series[len(blocks[i].series)-1]
+			if h := HistogramAt(it); h != nil {
+				cs.histograms = append(cs.histograms, histogramSample{t: t, h: h})
+				continue
+			}
+			// The number of samples of a chunk is limited, a new one is cut
+			// every maxSamplesPerChunk samples.
+			if n := len(cs.chunks); n == 0 || cs.chunks[n-1].NumSamples() >= maxSamplesPerChunk {
+				chk := chunkenc.NewXORChunk()
+				apps[i] = chk.Appender()
+				cs.chunks = append(cs.chunks, chk)
+			}
+			apps[i].Append(t, v)
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if err := set.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, b := range blocks {
+		b.size = int64(len(b.key))
+		for _, s := range b.series {
+			for _, chk := range s.chunks {
+				b.size += int64(len(chk.Bytes()))
+			}
+			for _, hs := range s.histograms {
+				b.size += histogramSize(hs.h)
+			}
+			for _, l := range s.lset {
+				b.size += int64(len(l.Name) + len(l.Value))
+			}
+		}
+		q.cache.add(b)
+	}
+	return blocks, nil
+}
+
+// histogramSize returns the approximate memory size of a histogram in bytes.
+func histogramSize(h *histogram.FloatHistogram) int64 {
+	return 48 + 8*int64(len(h.PositiveSpans)+len(h.NegativeSpans)+len(h.PositiveBuckets)+len(h.NegativeBuckets))
+}
+
+// selectNext selects the series in the inclusive range [mint, maxt] from the
+// underlying queryable.
+func (q *cachingQuerier) selectNext(mint, maxt int64, p *SelectParams, matchers []*labels.Matcher) (SeriesSet, error) {
+	querier, err := q.next.Querier(q.ctx, mint, maxt)
+	if err != nil {
+		return nil, err
+	}
+	defer querier.Close()
+
+	if p != nil {
+		cp := *p
+		cp.Start, cp.End = mint, maxt
+		p = &cp
+	}
+	return querier.Select(p, matchers...)
+}
+
+// LabelValues implements storage.Querier and is not cached.
+func (q *cachingQuerier) LabelValues(name string) ([]string, error) {
+	querier, err := q.next.Querier(q.ctx, q.mint, q.maxt)
+	if err != nil {
+		return nil, err
+	}
+	defer querier.Close()
+	return querier.LabelValues(name)
+}
+
+// Close implements storage.Querier and is a noop.
+func (q *cachingQuerier) Close() error {
+	return nil
+}
+
+// matchersKey returns a key identifying the set of matchers regardless of
+// their order.
+func matchersKey(matchers []*labels.Matcher) string {
+	strs := make([]string, 0, len(matchers))
+	for _, m := range matchers {
+		strs = append(strs, m.String())
+	}
+	sort.Strings(strs)
+	return strings.Join(strs, ",")
+}
+
+// floorDiv returns x/y rounded towards negative infinity.
+func floorDiv(x, y int64) int64 {
+	d := x / y
+	if x%y != 0 && (x < 0) != (y < 0) {
+		d--
+	}
+	return d
+}
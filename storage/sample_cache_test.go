@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+)
+
+func TestSampleCache(t *testing.T) {
+	h := NewHead(24*time.Hour, 0)
+	app, _ := h.Appender()
+	lset := labels.FromStrings(labels.MetricName, "up", "job", "a")
+	for ts := int64(0); ts <= 10*3600*1000; ts += 60000 {
+		app.Add(lset, ts, float64(ts))
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var reads [][2]int64
+	next := QueryableFunc(func(ctx context.Context, mint, maxt int64) (Querier, error) {
+		reads = append(reads, [2]int64{mint, maxt})
+		return h.Querier(ctx, mint, maxt)
+	})
+	cache := NewSampleCache(time.Hour, 1<<20)
+	// The block from 8h to 9h is the last complete one.
+	cache.now = func() time.Time { return time.Unix(10*3600, 0) }
+	q := CachingQueryable(next, cache, "test")
+
+	m, _ := labels.NewMatcher(labels.MatchEqual, "job", "a")
+	cases := []struct {
+		mint, maxt int64
+		reads      [][2]int64
+	}{
+		{mint: 3600*1000 + 1, maxt: 3 * 3600 * 1000, reads: [][2]int64{{3600 * 1000, 4*3600*1000 - 1}}},
+		{mint: 0, maxt: 3*3600*1000 - 1, reads: [][2]int64{{0, 3600*1000 - 1}}},
+		{mint: 2 * 3600 * 1000, maxt: 10 * 3600 * 1000, reads: [][2]int64{{4 * 3600 * 1000, 9*3600*1000 - 1}, {9 * 3600 * 1000, 10 * 3600 * 1000}}},
+		{mint: 0, maxt: 9*3600*1000 - 1, reads: nil},
+	}
+	for i, c := range cases {
+		reads = nil
+		querier, _ := q.Querier(context.Background(), c.mint, c.maxt)
+		set, err := querier.Select(nil, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reads) != len(c.reads) {
+			t.Fatalf("%d: expected reads %v, got %v", i, c.reads, reads)
+		}
+		for j := range reads {
+			if reads[j] != c.reads[j] {
+				t.Fatalf("%d: expected reads %v, got %v", i, c.reads, reads)
+			}
+		}
+
+		if !set.Next() {
+			t.Fatalf("%d: expected a series", i)
+		}
+		if !labels.Equal(set.At().Labels(), lset) {
+			t.Fatalf("%d: unexpected labels %s", i, set.At().Labels())
+		}
+		expected := c.maxt/60000 - (c.mint+59999)/60000 + 1
+		var n int64
+		it := set.At().Iterator()
+		for it.Next() {
+			ts, v := it.At()
+			if ts < c.mint || ts > c.maxt || v != float64(ts) {
+				t.Fatalf("%d: unexpected sample %d %f", i, ts, v)
+			}
+			n++
+		}
+		if n != expected {
+			t.Fatalf("%d: expected %d samples, got %d", i, expected, n)
+		}
+	}
+}
+
+func TestSampleCacheLargeBlock(t *testing.T) {
+	// More samples per block than fit into a single XOR chunk.
+	const samples = 70000
+	h := NewHead(48*time.Hour, 0)
+	app, _ := h.Appender()
+	lset := labels.FromStrings(labels.MetricName, "up", "job", "a")
+	for ts := int64(0); ts < samples*1000; ts += 1000 {
+		app.Add(lset, ts, float64(ts))
+	}
+	if err := app.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var params []*SelectParams
+	next := QueryableFunc(func(ctx context.Context, mint, maxt int64) (Querier, error) {
+		q, err := h.Querier(ctx, mint, maxt)
+		return &recordingQuerier{Querier: q, params: &params}, err
+	})
+	cache := NewSampleCache(24*time.Hour, 1<<30)
+	cache.now = func() time.Time { return time.Unix(48*3600, 0) }
+	q := CachingQueryable(next, cache, "test")
+
+	m, _ := labels.NewMatcher(labels.MatchEqual, "job", "a")
+	for i := 0; i < 2; i++ {
+		querier, _ := q.Querier(context.Background(), 0, samples*1000)
+		set, err := querier.Select(&SelectParams{Step: 60000, Func: "rate"}, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !set.Next() {
+			t.Fatalf("%d: expected a series", i)
+		}
+		var n int
+		it := set.At().Iterator()
+		for it.Next() {
+			if ts, v := it.At(); ts != int64(n)*1000 || v != float64(ts) {
+				t.Fatalf("%d: unexpected sample %d %f", i, ts, v)
+			}
+			n++
+		}
+		if n != samples {
+			t.Fatalf("%d: expected %d samples, got %d", i, samples, n)
+		}
+	}
+
+	// The block is fetched once without the hints of the select.
+	if len(params) != 1 || params[0].Func != "" || params[0].Step != 0 {
+		t.Fatalf("unexpected selects %v", params)
+	}
+}
+
+// recordingQuerier records the params of all selects.
+type recordingQuerier struct {
+	Querier
+	params *[]*SelectParams
+}
+
+func (q *recordingQuerier) Select(p *SelectParams, matchers ...*labels.Matcher) (SeriesSet, error) {
+	*q.params = append(*q.params, p)
+	return q.Querier.Select(p, matchers...)
+}
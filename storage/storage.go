@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/prometheus/common/model"
 
@@ -10,27 +11,52 @@ import (
 
 type storage struct {
 	queryables []Queryable
+	explainers []Explainer
 }
 
-func NewStorage(configs []*RemoteReadConfig) (Storage, error) {
-	queryables := make([]Queryable, 0, len(configs))
-	for _, conf := range configs {
-		c, err := NewClient(0, &ClientConfig{
+// NewStorage returns a Storage reading from the given remote read endpoints.
+// Additional local queryables, such as a Head fed by remote write, are merged
+// with the remote results.
+func NewStorage(configs []*RemoteReadConfig, local ...Queryable) (Storage, error) {
+	queryables := make([]Queryable, 0, len(configs)+len(local))
+	explainers := make([]Explainer, 0, len(configs)+len(local))
+	for i, conf := range configs {
+		c, err := NewClient(i, &ClientConfig{
 			URL:              conf.URL,
 			Timeout:          conf.RemoteTimeout,
 			HTTPClientConfig: conf.HTTPClientConfig,
+			Reg:              conf.Reg,
+			MaxRetries:       conf.MaxRetries,
+			BreakerThreshold: conf.BreakerThreshold,
+			BreakerCooldown:  time.Duration(conf.BreakerCooldown),
+			CoalesceReads:    conf.CoalesceReads,
 		})
 		if err != nil {
 			return nil, err
 		}
 		q := QueryableClient(c)
+		if conf.SampleCache != nil {
+			q = CachingQueryable(q, conf.SampleCache, conf.URL.String())
+		}
+		var required []*labels.Matcher
 		if len(conf.RequiredMatchers) > 0 {
-			q = RequiredMatchersFilter(q, labelsToEqualityMatchers(conf.RequiredMatchers))
+			required = labelsToEqualityMatchers(conf.RequiredMatchers)
+			q = RequiredMatchersFilter(q, required)
 		}
 		queryables = append(queryables, q)
+		explainers = append(explainers, &endpointExplainer{client: c, required: required})
+	}
+	for _, q := range local {
+		queryables = append(queryables, q)
+		if e, ok := q.(Explainer); ok {
+			explainers = append(explainers, e)
+		} else {
+			explainers = append(explainers, localExplainer{q: q})
+		}
 	}
 	return &storage{
 		queryables: queryables,
+		explainers: explainers,
 	}, nil
 }
 
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"net/http"
+
+	"github.com/lwangrabbit/promql-sdk/prompb"
+)
+
+type writeHandler struct {
+	appendable Appendable
+}
+
+// NewWriteHandler creates a http.Handler that accepts remote write requests
+// and writes them to the provided appendable.
+func NewWriteHandler(appendable Appendable) http.Handler {
+	return &writeHandler{
+		appendable: appendable,
+	}
+}
+
+func (h *writeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeWriteRequest(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, ts := range req.Timeseries {
+		if err := validateLabelsAndMetricName(labelProtosToLabels(ts.Labels)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(ts.Histograms) > 0 {
+			// The head only stores float samples. Reject the request rather
+			// than dropping the histograms silently.
+			http.Error(w, "native histograms are not supported", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = h.write(req)
+	switch err {
+	case nil:
+	case ErrOutOfOrderSample, ErrOutOfBounds, ErrDuplicateSampleForTimestamp, ErrTooManySeries:
+		// Indicate an out-of-order sample is a bad request to prevent retries.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *writeHandler) write(req *prompb.WriteRequest) error {
+	app, err := h.appendable.Appender()
+	if err != nil {
+		return err
+	}
+
+	for _, ts := range req.Timeseries {
+		ls := labelProtosToLabels(ts.Labels)
+		var ref uint64
+		for i, s := range ts.Samples {
+			if i == 0 {
+				ref, err = app.Add(ls, s.Timestamp, s.Value)
+			} else {
+				err = app.AddFast(ls, ref, s.Timestamp, s.Value)
+			}
+			if err != nil {
+				app.Rollback()
+				return err
+			}
+		}
+	}
+
+	return app.Commit()
+}
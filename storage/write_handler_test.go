@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/labels"
+	"github.com/lwangrabbit/promql-sdk/prompb"
+)
+
+func TestWriteHandlerBodyLimit(t *testing.T) {
+	body := bytes.NewReader(make([]byte, decodeWriteLimit+1))
+	rec := httptest.NewRecorder()
+	NewWriteHandler(NewHead(time.Hour, 0)).ServeHTTP(rec, httptest.NewRequest("POST", "/write", body))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "exceeds") {
+		t.Fatalf("unexpected error %q", rec.Body.String())
+	}
+}
+
+func TestWriteHandlerDecodedLimit(t *testing.T) {
+	// A snappy stream starts with the varint encoded decompressed length.
+	var body bytes.Buffer
+	for n := uint64(decodedWriteLimit + 1); ; n >>= 7 {
+		if n < 0x80 {
+			body.WriteByte(byte(n))
+			break
+		}
+		body.WriteByte(byte(n) | 0x80)
+	}
+	rec := httptest.NewRecorder()
+	NewWriteHandler(NewHead(time.Hour, 0)).ServeHTTP(rec, httptest.NewRequest("POST", "/write", &body))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "decompressed write request exceeds") {
+		t.Fatalf("unexpected error %q", rec.Body.String())
+	}
+}
+
+func TestWriteHandlerHistograms(t *testing.T) {
+	req := &prompb.WriteRequest{
+		Timeseries: []*prompb.TimeSeries{{
+			Labels:  labelsToLabelsProto(labels.FromStrings(labels.MetricName, "h")),
+			Samples: []prompb.Sample{{Timestamp: 0, Value: 1}},
+			Histograms: []prompb.Histogram{{
+				Count:     &prompb.Histogram_CountFloat{CountFloat: 3},
+				ZeroCount: &prompb.Histogram_ZeroCountFloat{},
+				Timestamp: 15000,
+			}},
+		}},
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHead(time.Hour, 0)
+	rec := httptest.NewRecorder()
+	NewWriteHandler(h).ServeHTTP(rec, httptest.NewRequest("POST", "/write", bytes.NewReader(snappy.Encode(nil, data))))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// None of the samples of the request are written.
+	q, err := h.Querier(context.Background(), 0, 15000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, _ := labels.NewMatcher(labels.MatchEqual, labels.MetricName, "h")
+	set, err := q.Select(nil, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Next() {
+		t.Fatalf("unexpected series %v", set.At().Labels())
+	}
+}
@@ -15,9 +15,11 @@ package stats
 
 import (
 	"context"
+	"encoding/json"
 
-	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/lwangrabbit/promql-sdk/pkg/tracing"
 )
 
 // QueryTiming identifies the code area or functionality in which time is spent
@@ -84,9 +86,62 @@ type queryTimings struct {
 	ExecTotalTime        float64 `json:"execTotalTime"`
 }
 
-// QueryStats currently only holding query timings.
+// QueryStats holds the query timings and, if requested, the detailed sample
+// statistics.
 type QueryStats struct {
-	Timings queryTimings `json:"timings,omitempty"`
+	Timings queryTimings  `json:"timings,omitempty"`
+	Samples *QuerySamples `json:"samples,omitempty"`
+}
+
+// QuerySamples holds the detailed sample statistics of a query.
+type QuerySamples struct {
+	// TotalSamples is the number of samples loaded by the selectors.
+	TotalSamples int `json:"totalQueryableSamples"`
+	// PeakSamples is the highest number of samples held in memory at once.
+	PeakSamples int `json:"peakSamples"`
+	// SeriesPerSelector is the number of series fetched per selector.
+	SeriesPerSelector map[string]int `json:"seriesPerSelector"`
+	// RemoteBytes is the size of the compressed responses per remote
+	// endpoint.
+	RemoteBytes map[string]int64 `json:"remoteBytesPerEndpoint"`
+	// SamplesPerStep is the number of samples loaded for each step of a
+	// range query.
+	SamplesPerStep []StepSamples `json:"totalQueryableSamplesPerStep,omitempty"`
+}
+
+// NewQuerySamples returns empty sample statistics.
+func NewQuerySamples() *QuerySamples {
+	return &QuerySamples{
+		SeriesPerSelector: map[string]int{},
+		RemoteBytes:       map[string]int64{},
+	}
+}
+
+// StepSamples is the number of samples loaded for the step at T, in
+// milliseconds. It is encoded like a point, [<seconds>, <samples>].
+type StepSamples struct {
+	T int64
+	V int
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s StepSamples) MarshalJSON() ([]byte, error) {
+	return json.Marshal([...]interface{}{float64(s.T) / 1000, s.V})
+}
+
+type detailedKey struct{}
+
+// WithDetailed returns a copy of the context requesting the detailed sample
+// statistics of the queries executed with it.
+func WithDetailed(ctx context.Context) context.Context {
+	return context.WithValue(ctx, detailedKey{}, true)
+}
+
+// DetailedFromContext reports whether the context requests detailed sample
+// statistics.
+func DetailedFromContext(ctx context.Context) bool {
+	detailed, _ := ctx.Value(detailedKey{}).(bool)
+	return detailed
 }
 
 // NewQueryStats makes a QueryStats struct with all QueryTimings found in the
@@ -120,11 +175,11 @@ type SpanTimer struct {
 	timer     *Timer
 	observers []prometheus.Observer
 
-	span opentracing.Span
+	span tracing.Span
 }
 
 func NewSpanTimer(ctx context.Context, operation string, timer *Timer, observers ...prometheus.Observer) (*SpanTimer, context.Context) {
-	span, ctx := opentracing.StartSpanFromContext(ctx, operation)
+	span, ctx := tracing.StartSpan(ctx, operation)
 	timer.Start()
 
 	return &SpanTimer{
@@ -137,7 +192,7 @@ func NewSpanTimer(ctx context.Context, operation string, timer *Timer, observers
 
 func (s *SpanTimer) Finish() {
 	s.timer.Stop()
-	s.span.Finish()
+	s.span.End()
 
 	for _, obs := range s.observers {
 		obs.Observe(s.timer.ElapsedTime().Seconds())
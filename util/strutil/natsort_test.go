@@ -0,0 +1,18 @@
+package strutil
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestNaturalLess(t *testing.T) {
+	in := []string{"node10", "node2", "node1", "a", "", "node02", "node2b", "node2a", "b1"}
+	exp := []string{"", "a", "b1", "node1", "node2", "node2a", "node2b", "node02", "node10"}
+
+	sort.Slice(in, func(i, j int) bool { return NaturalLess(in[i], in[j]) })
+	for i := range exp {
+		if in[i] != exp[i] {
+			t.Fatalf("expected %q, got %q", exp, in)
+		}
+	}
+}